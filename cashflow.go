@@ -0,0 +1,149 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// months returns the number of months between
+// occurrences, or 0 for Never.
+func (f Frequency) months() int {
+	switch f {
+	case Monthly:
+		return 1
+	case Quarterly:
+		return 3
+	case Annually:
+		return 12
+	}
+	return 0
+}
+
+// String returns the name of a frequency, as in a scenario file.
+func (f Frequency) String() string {
+	switch f {
+	case Monthly:
+		return "monthly"
+	case Quarterly:
+		return "quarterly"
+	case Annually:
+		return "annually"
+	case Never:
+		return "never"
+	}
+	return fmt.Sprintf("Frequency(%d)", int(f))
+}
+
+// valid returns true if f is one of the defined frequencies.
+func (f Frequency) valid() bool {
+	return f >= Monthly && f <= Never
+}
+
+// includes returns true if the frequency occurs in a month.
+func (f Frequency) includes(date Date) bool {
+	months := f.months()
+	return months > 0 && (int(date.Month())-1)%months == 0
+}
+
+// validatePolicy verifies the rebalance policy, cash flows and costs.
+func (sc *StockScenario) validatePolicy() error {
+	if !sc.Rebalance.Every.valid() {
+		return errors.New("invalid rebalance frequency")
+	}
+
+	if sc.Rebalance.Band < 0 {
+		return errors.New("rebalance Band less than 0")
+	}
+
+	for i, cf := range sc.CashFlows {
+		if !cf.Every.valid() {
+			return fmt.Errorf("cash flow %d has invalid frequency", i)
+		}
+		if cf.Amount == 0 {
+			return fmt.Errorf("cash flow %d Amount is 0", i)
+		}
+		if cf.Until != nil && *cf.Until < cf.Date {
+			return fmt.Errorf("cash flow %d Until before Date", i)
+		}
+	}
+
+	if sc.Costs.Commission < 0 {
+		return errors.New("Commission less than 0")
+	}
+
+	if sc.Costs.TradePct < 0 || sc.Costs.TradePct >= 1 {
+		return errors.New("TradePct not between 0 and 1")
+	}
+
+	return nil
+}
+
+// applyCashFlows adds the cash flows which occur after the prior
+// results date, through the results date, to cash. Each cash flow's
+// next occurrence is kept in sc.nextCashFlows.
+func (sr *ScenarioResults) applyCashFlows(sc *StockScenario, prevDate Date) {
+	for i, cf := range sc.CashFlows {
+		for ; cf.Every != Never || sc.nextCashFlows[i] == 0; sc.nextCashFlows[i]++ {
+			date := cf.Date.AddMonths(sc.nextCashFlows[i] * cf.Every.months())
+			if date > sr.Date || (cf.Until != nil && date > *cf.Until) {
+				break
+			}
+			if date > prevDate {
+				sr.CashFlow += cf.Amount
+			}
+		}
+	}
+
+	sr.Cash += sr.CashFlow
+	sr.Value += sr.CashFlow
+}
+
+// drifted returns true if the percent of the portfolio in any stock
+// differs from its PctHolding, or Schedule percent, by more than the
+// rebalance Band. The Band is not used with a Strategy.
+func (sr *ScenarioResults) drifted(sc *StockScenario) bool {
+	if sc.Rebalance.Band <= 0 || sc.Strategy != nil || sr.Value <= 0 {
+		return false
+	}
+
+	pcts := sc.PctHolding
+	if sc.Schedule != nil {
+		pcts = sc.Schedule.pctsOn(sr.Date)
+	}
+	pcts = sc.harvestPcts(sr, pcts, sr.Value)
+
+	for i, stock := range sc.Stocks {
+		value := sr.Shares[i].Value(stock.History[sr.StockHistIdx[i]].Close)
+		if math.Abs(value.Float()/sr.Value.Float()-pcts[i]) > sc.Rebalance.Band {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tradeCosts returns the costs of trading each stock
+// from its current shares to its percent of an amount.
+func (sr *ScenarioResults) tradeCosts(sc *StockScenario, pcts []float64, amt Money) Money {
+	if sc.Costs == (Costs{}) {
+		return 0
+	}
+
+	costs := Money(0)
+	for i, stock := range sc.Stocks {
+		close := stock.History[sr.StockHistIdx[i]].Close
+		shares := close.Shares(amt.Mul(pcts[i]), sc.Options[i].Rounding.decimals())
+		if shares == sr.Shares[i] {
+			continue
+		}
+
+		traded := shares - sr.Shares[i]
+		if traded < 0 {
+			traded = -traded
+		}
+		costs += sc.Costs.Commission + traded.Value(close).Mul(sc.Costs.TradePct)
+	}
+
+	return costs
+}
@@ -0,0 +1,228 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// newTestScenario returns a 60/40 scenario for 2016 through 2020
+// where shares only change when rebalancing.
+func newTestScenario() *StockScenario {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+
+	sc := NewStockScenario(MustParseDate("2016-01-01"), MustParseDate("2020-12-31"))
+	sc.AddStock(fxaix, .6)
+	sc.AddStock(fxnax, .4)
+	sc.SetStockOptions("FXAIX", StockOptions{Dividends: AccumulateCash})
+	sc.SetStockOptions("FXNAX", StockOptions{Dividends: AccumulateCash})
+	return sc
+}
+
+// rebalanceDates returns the dates the shares of a scenario changed.
+func rebalanceDates(sc *StockScenario) []Date {
+	var dates []Date
+	for i := 1; i < len(sc.Results); i++ {
+		if sc.Results[i].Shares[0] != sc.Results[i-1].Shares[0] {
+			dates = append(dates, sc.Results[i].Date)
+		}
+	}
+	return dates
+}
+
+func TestRebalancePolicy(t *testing.T) {
+	tests := []struct {
+		policy RebalancePolicy
+		count  int
+	}{
+		{RebalancePolicy{}, 60},
+		{RebalancePolicy{Every: Quarterly}, 20},
+		{RebalancePolicy{Every: Annually}, 5},
+		{RebalancePolicy{Every: Never}, 0},
+	}
+
+	for _, test := range tests {
+		sc := newTestScenario()
+		sc.Rebalance = test.policy
+		if err := sc.CalcResults(10000); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dates := rebalanceDates(sc)
+		if len(dates) != test.count {
+			t.Errorf("%+v rebalanced %d times, expected %d", test.policy, len(dates), test.count)
+		}
+		for _, date := range dates {
+			if !test.policy.Every.includes(date) || date.Day() < 15 {
+				t.Errorf("%+v rebalanced on %s", test.policy, date)
+			}
+		}
+	}
+
+	// a band only rebalances when a stock drifts
+	sc := newTestScenario()
+	sc.Rebalance = RebalancePolicy{Every: Never, Band: .05}
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dates := rebalanceDates(sc)
+	if len(dates) == 0 || len(dates) > 10 {
+		t.Errorf("band rebalanced %d times", len(dates))
+	}
+	for _, sr := range sc.Results {
+		pct := sr.Shares[0].Value(sc.Stocks[0].History[sr.StockHistIdx[0]].Close).Float() / sr.Value.Float()
+		if math.Abs(pct-.6) > .05 {
+			t.Fatalf("%s drifted to %g", sr.Date, pct)
+		}
+	}
+
+	sc.Rebalance.Band = -1
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error negative band")
+	}
+}
+
+func TestCashFlows(t *testing.T) {
+	base := newTestScenario()
+	base.CalcResults(10000)
+
+	until := MustParseDate("2016-12-31")
+	sc := newTestScenario()
+	sc.CashFlows = []CashFlow{
+		{Date: MustParseDate("2016-02-01"), Amount: NewMoney(500), Until: &until},
+		{Date: MustParseDate("2018-06-01"), Amount: NewMoney(-2000), Every: Never},
+	}
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sc.NetCashFlow != NewMoney(11*500-2000) {
+		t.Errorf("net cash flow %s, expected 3,500.00", sc.NetCashFlow)
+	}
+
+	// the time weighted return is close to the return without cash flows
+	if math.Abs(sc.CAGR-base.CAGR) > .002 {
+		t.Errorf("CAGR %g with cash flows, %g without", sc.CAGR, base.CAGR)
+	}
+
+	if sc.EndAmt <= base.EndAmt {
+		t.Errorf("end amount %s not more than %s without deposits", sc.EndAmt, base.EndAmt)
+	}
+
+	for _, sr := range sc.Results {
+		if sr.CashFlow != 0 && sr.Cash > NewMoney(100) {
+			t.Errorf("%s cash flow not invested: %s", sr.Date, sr.Cash)
+		}
+	}
+
+	// month end deposits stay at the end of the month
+	sc.CashFlows = []CashFlow{{Date: MustParseDate("2016-01-31"), Amount: NewMoney(100), Until: &until}}
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sc.NetCashFlow != NewMoney(1200) {
+		t.Errorf("net cash flow %s, expected 1,200.00", sc.NetCashFlow)
+	}
+	for _, sr := range sc.Results {
+		if sr.Date.Month() == time.March && sr.CashFlow != 0 && sr.Date.Day() < 31 {
+			t.Errorf("%s cash flow %s, expected on March 31", sr.Date, sr.CashFlow)
+		}
+	}
+
+	sc.CashFlows = []CashFlow{{Date: MustParseDate("2017-01-03"), Amount: NewMoney(-100000), Every: Never}}
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error withdrawal more than value")
+	}
+
+	// deposits on or before the start are added to the initial amount
+	sc.CashFlows = []CashFlow{
+		{Date: MustParseDate("2015-12-01"), Amount: NewMoney(1000), Every: Never},
+		{Date: MustParseDate("2016-01-01"), Amount: NewMoney(5000), Every: Never},
+	}
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sc.NetCashFlow != NewMoney(6000) || sc.Results[0].Value != NewMoney(16000) {
+		t.Errorf("net cash flow %s, first value %s, expected 6,000.00 and 16,000.00",
+			sc.NetCashFlow, sc.Results[0].Value)
+	}
+	if math.Abs(sc.EndAmt.Float()/base.EndAmt.Float()-1.6) > .01 {
+		t.Errorf("end amount %s, expected 1.6 times %s", sc.EndAmt, base.EndAmt)
+	}
+
+	sc.CashFlows = []CashFlow{{Date: MustParseDate("2016-01-01"), Amount: NewMoney(-10000), Every: Never}}
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error withdrawal of the initial amount")
+	}
+
+	// the zero Date is a date, not a missing Until
+	until = 0
+	sc.CashFlows = []CashFlow{{Date: MustParseDate("2016-01-31"), Amount: NewMoney(100), Until: &until}}
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error Until before Date")
+	}
+}
+
+func TestCashFlowsTax(t *testing.T) {
+	tax := &TaxModel{QualifiedRate: .15, OrdinaryRate: .3, ShortTermRate: .3, LongTermRate: .15, Liquidate: true}
+
+	base := newTestScenario()
+	base.Tax = tax
+	base.CalcResults(10000)
+
+	sc := newTestScenario()
+	sc.Tax = tax
+	sc.CashFlows = []CashFlow{{Date: MustParseDate("2016-02-01"), Amount: NewMoney(1000), Every: Monthly}}
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the deposits are not counted as return
+	years := float64(sc.EndDate.Sub(sc.StartDate)) / 365.25
+	if growth := math.Pow(1+sc.CAGR, years); math.Abs(growth-1-sc.PctChange) > 1e-9 {
+		t.Errorf("pct change %g does not match CAGR %g", sc.PctChange, sc.CAGR)
+	}
+	if math.Abs(sc.PctChange-base.PctChange) > .02 {
+		t.Errorf("pct change %g with cash flows, %g without", sc.PctChange, base.PctChange)
+	}
+
+	if sc.AfterTaxCAGR >= sc.CAGR || sc.CAGR-sc.AfterTaxCAGR > .02 {
+		t.Errorf("after tax CAGR %g, CAGR %g", sc.AfterTaxCAGR, sc.CAGR)
+	}
+	if math.Abs(sc.AfterTaxCAGR-base.AfterTaxCAGR) > .005 {
+		t.Errorf("after tax CAGR %g with cash flows, %g without", sc.AfterTaxCAGR, base.AfterTaxCAGR)
+	}
+}
+
+func TestCosts(t *testing.T) {
+	base := newTestScenario()
+	base.CalcResults(10000)
+
+	sc := newTestScenario()
+	sc.Costs = Costs{Commission: NewMoney(1), TradePct: .001}
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the first purchase of both stocks costs at least 2 + .1%
+	if sc.Results[0].Costs < NewMoney(11.9) || sc.TradingCosts <= sc.Results[0].Costs {
+		t.Errorf("costs %s first day, %s total", sc.Results[0].Costs, sc.TradingCosts)
+	}
+
+	if sc.EndAmt >= base.EndAmt {
+		t.Errorf("end amount %s with costs not less than %s", sc.EndAmt, base.EndAmt)
+	}
+
+	for _, sr := range sc.Results {
+		if sr.Cash < 0 {
+			t.Fatalf("%s cash %s after costs", sr.Date, sr.Cash)
+		}
+	}
+
+	sc.Costs.TradePct = 1
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error TradePct 1")
+	}
+}
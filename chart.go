@@ -0,0 +1,490 @@
+package portfolio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// growthAmount is the initial amount in growth charts.
+const growthAmount = 10000
+
+// chartKinds are the names of the kinds of charts.
+var chartKinds = []string{"growth", "log", "drawdown", "allocation", "annual"}
+
+// chartColors are the colors of the series in a chart.
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+	"#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// ParseChartKind parses the name of a kind of chart:
+// growth, log, drawdown, allocation or annual.
+func ParseChartKind(s string) (ChartKind, error) {
+	for i, name := range chartKinds {
+		if strings.EqualFold(s, name) {
+			return ChartKind(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid chart %q, must be one of %s", s, strings.Join(chartKinds, ", "))
+}
+
+func (k ChartKind) String() string {
+	if k < 0 || int(k) >= len(chartKinds) {
+		return fmt.Sprintf("ChartKind(%d)", int(k))
+	}
+	return chartKinds[k]
+}
+
+// title returns the default title of a kind of chart.
+func (k ChartKind) title() string {
+	switch k {
+	case GrowthChart:
+		return "Growth of $10,000"
+	case LogGrowthChart:
+		return "Growth of $10,000 (log scale)"
+	case DrawdownChart:
+		return "Drawdown"
+	case AllocationChart:
+		return "Allocation"
+	case AnnualReturnsChart:
+		return "Annual returns"
+	}
+	return k.String()
+}
+
+// WriteChart writes an SVG chart of the scenario's results.
+func (sc *StockScenario) WriteChart(w io.Writer, kind ChartKind, opts ChartOptions) error {
+	if opts.Title == "" {
+		opts.Title = kind.title()
+		if label := sc.label(); label != "" {
+			opts.Title = label + ": " + opts.Title
+		}
+	}
+
+	if kind == AllocationChart {
+		return sc.writeAllocationChart(w, opts)
+	}
+
+	c, err := Compare(sc)
+	if err != nil {
+		return err
+	}
+	return c.WriteChart(w, kind, opts)
+}
+
+// WriteChart writes an SVG chart comparing the scenarios. All kinds
+// of charts other than AllocationChart are supported.
+func (c *Comparison) WriteChart(w io.Writer, kind ChartKind, opts ChartOptions) error {
+	if opts.Title == "" {
+		opts.Title = kind.title()
+	}
+
+	var names []string
+	for _, s := range c.Summaries {
+		names = append(names, s.Name)
+	}
+
+	series := make([][]float64, len(c.Growth))
+	switch kind {
+	case GrowthChart, LogGrowthChart:
+		for s, growth := range c.Growth {
+			for _, g := range growth {
+				series[s] = append(series[s], g*growthAmount)
+			}
+		}
+		return writeLineChart(w, opts, names, c.Dates, series, kind == LogGrowthChart, formatDollars)
+
+	case DrawdownChart:
+		for s, growth := range c.Growth {
+			series[s] = drawdowns(growth)
+		}
+		return writeLineChart(w, opts, names, c.Dates, series, false, formatTickPct)
+
+	case AnnualReturnsChart:
+		var years []string
+		for _, year := range c.Years {
+			years = append(years, strconv.Itoa(year))
+		}
+		return writeBarChart(w, opts, names, years, c.YearReturns)
+	}
+
+	return fmt.Errorf("%s chart not supported for a comparison", kind)
+}
+
+// writeAllocationChart writes a stacked area chart of the percent
+// of the portfolio in each stock, and in cash if any is held.
+func (sc *StockScenario) writeAllocationChart(w io.Writer, opts ChartOptions) error {
+	if len(sc.Results) < 2 {
+		return errors.New("scenario has no results")
+	}
+
+	var names []string
+	for _, stock := range sc.Stocks {
+		names = append(names, stock.Ticker)
+	}
+
+	dates := make([]Date, len(sc.Results))
+	series := make([][]float64, len(sc.Stocks)+1)
+	for i := range series {
+		series[i] = make([]float64, len(sc.Results))
+	}
+
+	cash := false
+	for r, sr := range sc.Results {
+		dates[r] = sr.Date
+
+		gross := 0.0
+		for i, stock := range sc.Stocks {
+			series[i][r] = sr.Shares[i].Value(stock.History[sr.StockHistIdx[i]].Close).Float()
+			gross += series[i][r]
+		}
+		if held := (sr.Cash + sr.pendingTotal()).Float(); held > 0 {
+			series[len(sc.Stocks)][r] = held
+			gross += held
+			cash = true
+		}
+
+		for i := range series {
+			if gross > 0 {
+				series[i][r] /= gross
+			}
+		}
+	}
+
+	if cash {
+		names = append(names, "Cash")
+	} else {
+		series = series[:len(sc.Stocks)]
+	}
+
+	chart, err := newSVGChart(opts)
+	if err != nil {
+		return err
+	}
+
+	y := chart.yAxis(0, 1, false, formatTickPct)
+	x := chart.xAxis(dates)
+
+	total := make([]float64, len(dates))
+	for i, values := range series {
+		var points []string
+		for r := range dates {
+			points = append(points, point(x(dates[r]), y(total[r]+values[r])))
+		}
+		for r := len(dates) - 1; r >= 0; r-- {
+			points = append(points, point(x(dates[r]), y(total[r])))
+			total[r] += values[r]
+		}
+		fmt.Fprintf(&chart.b, `<polygon points="%s" fill="%s" fill-opacity="0.8"/>`+"\n",
+			strings.Join(points, " "), chartColors[i%len(chartColors)])
+	}
+
+	chart.legend(names)
+	return chart.write(w)
+}
+
+// writeLineChart writes a chart with a line for each series of values
+// on the dates, using a log scale if log is true.
+func writeLineChart(w io.Writer, opts ChartOptions, names []string, dates []Date,
+	series [][]float64, log bool, format func(v, step float64) string) error {
+
+	if len(dates) < 2 {
+		return errors.New("chart needs at least 2 dates")
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, values := range series {
+		for _, v := range values {
+			min, max = math.Min(min, v), math.Max(max, v)
+		}
+	}
+
+	chart, err := newSVGChart(opts)
+	if err != nil {
+		return err
+	}
+
+	y := chart.yAxis(min, max, log, format)
+	x := chart.xAxis(dates)
+
+	for s, values := range series {
+		points := make([]string, len(values))
+		for i, v := range values {
+			points[i] = point(x(dates[i]), y(v))
+		}
+		fmt.Fprintf(&chart.b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n",
+			strings.Join(points, " "), chartColors[s%len(chartColors)])
+	}
+
+	if len(names) > 1 {
+		chart.legend(names)
+	}
+	return chart.write(w)
+}
+
+// writeBarChart writes a bar chart with a group of bars for each label,
+// one for each series.
+func writeBarChart(w io.Writer, opts ChartOptions, names []string, labels []string, series [][]float64) error {
+	if len(labels) == 0 {
+		return errors.New("chart has no values")
+	}
+
+	min, max := 0.0, 0.0
+	for _, values := range series {
+		for _, v := range values {
+			min, max = math.Min(min, v), math.Max(max, v)
+		}
+	}
+
+	chart, err := newSVGChart(opts)
+	if err != nil {
+		return err
+	}
+
+	y := chart.yAxis(min, max, false, formatTickPct)
+
+	band := (chart.right - chart.left) / float64(len(labels))
+	barWidth := band * .8 / float64(len(series))
+	for i, label := range labels {
+		x := chart.left + band*float64(i)
+		fmt.Fprintf(&chart.b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n",
+			x+band/2, chart.bottom+16, html.EscapeString(label))
+
+		for s, values := range series {
+			top, bottom := y(math.Max(values[i], 0)), y(math.Min(values[i], 0))
+			fmt.Fprintf(&chart.b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n",
+				x+band*.1+barWidth*float64(s), top, barWidth, bottom-top, chartColors[s%len(chartColors)])
+		}
+	}
+
+	fmt.Fprintf(&chart.b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`+"\n",
+		chart.left, y(0), chart.right, y(0))
+
+	if len(names) > 1 {
+		chart.legend(names)
+	}
+	return chart.write(w)
+}
+
+// drawdowns returns the percent each growth is below its prior peak.
+func drawdowns(growth []float64) []float64 {
+	drawdowns := make([]float64, len(growth))
+	peak := 0.0
+	for i, g := range growth {
+		peak = math.Max(peak, g)
+		drawdowns[i] = g/peak - 1
+	}
+	return drawdowns
+}
+
+// svgChart is an SVG chart being drawn. The plot area is inside
+// margins for the title, axis labels and legend.
+type svgChart struct {
+	b                        bytes.Buffer
+	left, top, right, bottom float64
+}
+
+// newSVGChart starts a chart with a background and title.
+func newSVGChart(opts ChartOptions) (*svgChart, error) {
+	width, height := opts.Width, opts.Height
+	if width == 0 {
+		width = 800
+	}
+	if height == 0 {
+		height = 400
+	}
+	if width < 200 || height < 150 {
+		return nil, fmt.Errorf("chart size %d by %d less than 200 by 150", width, height)
+	}
+
+	c := &svgChart{left: 70, top: 40, right: float64(width) - 20, bottom: float64(height) - 30}
+	fmt.Fprintf(&c.b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" `+
+		`font-family="sans-serif" font-size="12">`+"\n", width, height, width, height)
+	fmt.Fprintf(&c.b, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	fmt.Fprintf(&c.b, `<text x="%d" y="24" text-anchor="middle" font-size="16">%s</text>`+"\n",
+		width/2, html.EscapeString(opts.Title))
+	return c, nil
+}
+
+// write writes the completed chart.
+func (c *svgChart) write(w io.Writer) error {
+	c.b.WriteString("</svg>\n")
+	_, err := c.b.WriteTo(w)
+	return err
+}
+
+// yAxis draws the y axis grid lines and labels for values from min
+// to max, and returns the function mapping a value to its y position.
+func (c *svgChart) yAxis(min, max float64, log bool, format func(v, step float64) string) func(v float64) float64 {
+	var ticks []float64
+	step := 0.0
+	if log && min > 0 {
+		ticks = logTicks(min, max)
+		min, max = math.Log10(min), math.Log10(max)
+		if min == max {
+			min, max = min-.01, max+.01
+		}
+	} else {
+		log = false
+		ticks, step = linearTicks(min, max)
+		min, max = ticks[0], ticks[len(ticks)-1]
+	}
+
+	y := func(v float64) float64 {
+		if log {
+			v = math.Log10(v)
+		}
+		return c.bottom - (v-min)/(max-min)*(c.bottom-c.top)
+	}
+
+	for _, tick := range ticks {
+		fmt.Fprintf(&c.b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n",
+			c.left, y(tick), c.right, y(tick))
+		fmt.Fprintf(&c.b, `<text x="%.1f" y="%.1f" text-anchor="end">%s</text>`+"\n",
+			c.left-6, y(tick)+4, format(tick, step))
+	}
+	return y
+}
+
+// xAxis draws the x axis labels for the dates, and returns
+// the function mapping a date to its x position.
+func (c *svgChart) xAxis(dates []Date) func(d Date) float64 {
+	start, end := dates[0], dates[len(dates)-1]
+	x := func(d Date) float64 {
+		return c.left + float64(d.Sub(start))/float64(end.Sub(start))*(c.right-c.left)
+	}
+
+	ticks, layout := dateTicks(start, end)
+	for _, tick := range ticks {
+		fmt.Fprintf(&c.b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n",
+			x(tick), c.top, x(tick), c.bottom)
+		fmt.Fprintf(&c.b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n",
+			x(tick), c.bottom+16, tick.Time().Format(layout))
+	}
+	return x
+}
+
+// legend draws a colored box and name for each series
+// across the top of the plot area.
+func (c *svgChart) legend(names []string) {
+	x := c.left + 8
+	for i, name := range names {
+		fmt.Fprintf(&c.b, `<rect x="%.1f" y="%.1f" width="10" height="10" fill="%s"/>`+"\n",
+			x, c.top+6, chartColors[i%len(chartColors)])
+		fmt.Fprintf(&c.b, `<text x="%.1f" y="%.1f">%s</text>`+"\n", x+14, c.top+15, html.EscapeString(name))
+		x += 30 + 7*float64(len(name))
+	}
+}
+
+// linearTicks returns about 5 evenly spaced ticks, on round numbers,
+// which include min and max, and the step between them.
+func linearTicks(min, max float64) ([]float64, float64) {
+	if min == max {
+		min, max = min-1, max+1
+	}
+
+	base := math.Pow(10, math.Floor(math.Log10((max-min)/5)))
+	step := base
+	for _, m := range []float64{1, 2, 5, 10} {
+		step = base * m
+		if (max-min)/step <= 6 {
+			break
+		}
+	}
+
+	var ticks []float64
+	first := math.Floor(min/step+1e-9) * step
+	for i := 0; ; i++ {
+		tick := first + float64(i)*step
+		ticks = append(ticks, tick)
+		if tick >= max-step*1e-9 {
+			break
+		}
+	}
+	return ticks, step
+}
+
+// logTicks returns ticks from min to max on 1, 2 and 5 times powers
+// of 10, or if there are fewer than 3 of those, on round numbers.
+func logTicks(min, max float64) []float64 {
+	var ticks []float64
+	for e := math.Floor(math.Log10(min)); e <= math.Ceil(math.Log10(max)); e++ {
+		for _, m := range []float64{1, 2, 5} {
+			if tick := m * math.Pow(10, e); tick >= min && tick <= max {
+				ticks = append(ticks, tick)
+			}
+		}
+	}
+	if len(ticks) >= 3 {
+		return ticks
+	}
+
+	ticks = nil
+	linear, _ := linearTicks(min, max)
+	for _, tick := range linear {
+		if tick >= min && tick <= max {
+			ticks = append(ticks, tick)
+		}
+	}
+	return ticks
+}
+
+// dateTicks returns at most 8 dates on the first of a month, evenly
+// spaced by 1, 3 or 6 months or a number of years, from start to end,
+// and the layout to format them.
+func dateTicks(start, end Date) ([]Date, string) {
+	first := NewDate(start.Year(), start.Month(), 1)
+	if first < start {
+		first = first.AddDate(0, 1, 0)
+	}
+
+	for _, months := range []int{1, 3, 6, 12, 24, 60, 120} {
+		var ticks []Date
+		for d := first; d <= end; d = d.AddDate(0, 1, 0) {
+			if months >= 12 && (d.Month() != 1 || d.Year()%(months/12) != 0) {
+				continue
+			}
+			if (int(d.Month())-1)%months%12 == 0 {
+				ticks = append(ticks, d)
+			}
+		}
+
+		if len(ticks) <= 8 {
+			if months < 12 {
+				return ticks, "Jan 2006"
+			}
+			return ticks, "2006"
+		}
+	}
+	return nil, ""
+}
+
+// point formats an x, y position in a list of points.
+func point(x, y float64) string {
+	return strconv.FormatFloat(x, 'f', 1, 64) + "," + strconv.FormatFloat(y, 'f', 1, 64)
+}
+
+// formatDollars formats an axis label as whole dollars, such as "$10,000".
+func formatDollars(v, step float64) string {
+	s := strconv.FormatFloat(math.Abs(math.Round(v)), 'f', 0, 64)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	if v < 0 {
+		return "-$" + s
+	}
+	return "$" + s
+}
+
+// formatTickPct formats an axis label as a percent, with a decimal
+// place if the ticks are less than 1% apart.
+func formatTickPct(v, step float64) string {
+	if step > 0 && step < .01 {
+		return fmt.Sprintf("%.1f%%", v*100)
+	}
+	return fmt.Sprintf("%.0f%%", v*100)
+}
@@ -0,0 +1,112 @@
+package portfolio
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+)
+
+// checkSVG verifies an SVG chart is well formed XML with elements of a kind.
+func checkSVG(t *testing.T, name string, svg []byte, element string) {
+	t.Helper()
+
+	count := 0
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s chart is not valid XML: %v", name, err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == element {
+			count++
+		}
+	}
+
+	if count == 0 {
+		t.Errorf("%s chart has no %s elements", name, element)
+	}
+}
+
+func TestWriteChart(t *testing.T) {
+	sc := newTestScenario()
+	sc.Name = "60/40 <AGG>"
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	elements := []string{"polyline", "polyline", "polyline", "polygon", "rect"}
+	for kind, element := range elements {
+		var b bytes.Buffer
+		if err := sc.WriteChart(&b, ChartKind(kind), ChartOptions{}); err != nil {
+			t.Fatalf("%s chart: unexpected error: %v", ChartKind(kind), err)
+		}
+		checkSVG(t, ChartKind(kind).String(), b.Bytes(), element)
+
+		if !strings.Contains(b.String(), "60/40 &lt;AGG&gt;") {
+			t.Errorf("%s chart title not escaped", ChartKind(kind))
+		}
+	}
+
+	if err := sc.WriteChart(ioutil.Discard, GrowthChart, ChartOptions{Width: 100}); err == nil {
+		t.Errorf("expected error for chart too small")
+	}
+
+	c, err := Compare(sc, sc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.WriteChart(ioutil.Discard, AllocationChart, ChartOptions{}); err == nil {
+		t.Errorf("expected error for allocation chart of a comparison")
+	}
+
+	var b bytes.Buffer
+	if err := c.WriteChart(&b, LogGrowthChart, ChartOptions{Title: "Log"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkSVG(t, "comparison", b.Bytes(), "polyline")
+}
+
+func TestParseChartKind(t *testing.T) {
+	for i, name := range chartKinds {
+		kind, err := ParseChartKind(strings.ToUpper(name))
+		if err != nil || kind != ChartKind(i) {
+			t.Errorf("ParseChartKind(%q) = %s, %v", name, kind, err)
+		}
+	}
+
+	if _, err := ParseChartKind("pie"); err == nil {
+		t.Errorf("expected error for pie chart")
+	}
+}
+
+func TestLinearTicks(t *testing.T) {
+	tests := []struct {
+		min, max float64
+		ticks    []float64
+	}{
+		{0, 1, []float64{0, .2, .4, .6, .8, 1}},
+		{-.12, .31, []float64{-.2, -.1, 0, .1, .2, .3, .4}},
+		{9876, 33857, []float64{5000, 10000, 15000, 20000, 25000, 30000, 35000}},
+	}
+
+	for _, test := range tests {
+		ticks, _ := linearTicks(test.min, test.max)
+		if len(ticks) != len(test.ticks) {
+			t.Errorf("linearTicks(%g, %g) = %v, expected %v", test.min, test.max, ticks, test.ticks)
+			continue
+		}
+		for i := range ticks {
+			if math.Abs(ticks[i]-test.ticks[i]) > 1e-9 {
+				t.Errorf("linearTicks(%g, %g) = %v, expected %v", test.min, test.max, ticks, test.ticks)
+				break
+			}
+		}
+	}
+}
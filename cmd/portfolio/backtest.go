@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	portfolio "github.com/ddgarrett/PortfolioAnalysis"
+)
+
+func runBacktest(args []string) error {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	var f scenarioFlags
+	f.add(fs, false)
+	var chart chartFlags
+	chart.add(fs)
+	jsonFile := fs.String("json", "", "write the summary and daily results as JSON to `file`")
+	csvFile := fs.String("csv", "", "write the daily results as CSV to `file`")
+	report := fs.String("report", "", "write an HTML report to `file`")
+	fs.Parse(args)
+
+	scenarios, err := f.scenarios()
+	if err != nil {
+		return err
+	}
+	sc := scenarios[0]
+
+	if *jsonFile != "" {
+		if err := writeFile(*jsonFile, sc.WriteJSON); err != nil {
+			return err
+		}
+	}
+	if *csvFile != "" {
+		if err := writeFile(*csvFile, sc.WriteCSV); err != nil {
+			return err
+		}
+	}
+	if err := chart.write(sc.WriteChart); err != nil {
+		return err
+	}
+	if *report != "" {
+		err := writeFile(*report, func(w io.Writer) error {
+			return portfolio.WriteReport(w, portfolio.ReportOptions{}, sc)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Holdings\t%s\n", holdString(sc))
+	fmt.Fprintf(w, "Period\t%s to %s\n", sc.StartDate, sc.EndDate)
+	if sc.StartLimitedBy != "" || sc.EndLimitedBy != "" {
+		fmt.Fprintf(w, "Limited by\t%s %s\n", sc.StartLimitedBy, sc.EndLimitedBy)
+	}
+	fmt.Fprintf(w, "Start amount\t%s\n", sc.StartAmt)
+	fmt.Fprintf(w, "End amount\t%s\n", sc.EndAmt)
+	fmt.Fprintf(w, "Total return\t%.2f%%\n", sc.PctChange*100)
+	fmt.Fprintf(w, "CAGR\t%.2f%%\n", sc.CAGR*100)
+	fmt.Fprintf(w, "Volatility\t%.2f%%\n", sc.Volatility()*100)
+	if sc.Income != 0 {
+		fmt.Fprintf(w, "Income\t%s\n", sc.Income)
+	}
+	return w.Flush()
+}
+
+// writeFile creates a file and writes it with a write function,
+// removing the file if the write fails.
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	return f.Close()
+}
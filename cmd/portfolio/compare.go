@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	portfolio "github.com/ddgarrett/PortfolioAnalysis"
+)
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	var f scenarioFlags
+	f.add(fs, true)
+	var chart chartFlags
+	chart.add(fs)
+	rate := fs.Float64("rf", 0, "annual risk free rate for the Sharpe ratio, such as 0.02")
+	report := fs.String("report", "", "write an HTML report to `file`")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: portfolio compare [flags] [FILE...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var scenarios []*portfolio.StockScenario
+	if len(f.holds.lists) > 0 {
+		var err error
+		if scenarios, err = f.scenarios(); err != nil {
+			return err
+		}
+		for _, sc := range scenarios {
+			sc.Name = holdString(sc)
+		}
+	}
+
+	for _, file := range fs.Args() {
+		def, err := portfolio.ReadScenarioFile(file)
+		if err != nil {
+			return err
+		}
+		def.LoadStock = loadStock
+		sc, _, err := def.Run()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		scenarios = append(scenarios, sc)
+	}
+
+	if len(scenarios) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no --hold flag or scenario file")
+	}
+
+	c, err := portfolio.CompareRiskFree(*rate, scenarios...)
+	if err != nil {
+		return err
+	}
+	if err := chart.write(c.WriteChart); err != nil {
+		return err
+	}
+	if *report != "" {
+		err := writeFile(*report, func(w io.Writer) error {
+			return portfolio.WriteReport(w, portfolio.ReportOptions{RiskFree: *rate}, scenarios...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return c.Write(os.Stdout)
+}
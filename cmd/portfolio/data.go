@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// dataDir is the directory containing the stock history.
+const dataDir = "data"
+
+func runData(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: portfolio data list | portfolio data show [flags] TICKER")
+	}
+
+	switch args[0] {
+	case "list":
+		return listData()
+	case "show":
+		return showData(args[1:])
+	}
+
+	return fmt.Errorf("unknown data command %q", args[0])
+}
+
+// listData prints the tickers with history and the dates of their history.
+func listData() error {
+	tickers, err := dataTickers()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Ticker\tFrom\tTo\tDays\t")
+	for _, ticker := range tickers {
+		stock, err := loadStock(ticker)
+		if err != nil {
+			return err
+		}
+		history := stock.History
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t\n", ticker, history[0].Date, history[len(history)-1].Date, len(history))
+	}
+	return w.Flush()
+}
+
+// dataTickers returns the sorted tickers with history in dataDir.
+func dataTickers() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dataDir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+
+	var tickers []string
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".csv")
+		// skip dividend, distribution, weekly and monthly files
+		if !strings.Contains(name, "_") {
+			tickers = append(tickers, name)
+		}
+	}
+	sort.Strings(tickers)
+	return tickers, nil
+}
+
+// showData prints the history of a ticker between two dates.
+func showData(args []string) error {
+	fs := flag.NewFlagSet("data show", flag.ExitOnError)
+	var f scenarioFlags
+	fs.StringVar(&f.from, "from", "", "start date")
+	fs.StringVar(&f.to, "to", "", "end date")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: portfolio data show [flags] TICKER")
+	}
+
+	from, to, err := f.dates()
+	if err != nil {
+		return err
+	}
+
+	stock, err := loadStock(strings.ToUpper(fs.Arg(0)))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Date\tClose\tDividend\tDistribution\t")
+	for _, h := range stock.History {
+		if h.Date >= from && h.Date <= to {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", h.Date, h.Close, h.Dividend, h.Distribution)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	portfolio "github.com/ddgarrett/PortfolioAnalysis"
+)
+
+// scenarioFlags are the flags which define a stock scenario.
+type scenarioFlags struct {
+	holds  holdList
+	from   string
+	to     string
+	amount float64
+	strict bool
+}
+
+// add registers the scenario flags. If multiple is true
+// --hold may be given more than once.
+func (f *scenarioFlags) add(fs *flag.FlagSet, multiple bool) {
+	f.holds.multiple = multiple
+	fs.Var(&f.holds, "hold", "tickers and weights, such as FXAIX=0.6,FXNAX=0.4")
+	fs.Float64Var(&f.amount, "amount", 10000, "initial amount")
+	f.addDates(fs)
+}
+
+// addDates adds only the --from, --to and --strict flags to a flag set.
+func (f *scenarioFlags) addDates(fs *flag.FlagSet) {
+	fs.StringVar(&f.from, "from", "", "start date (default first date with history for all tickers)")
+	fs.StringVar(&f.to, "to", "", "end date (default last date with history for all tickers)")
+	fs.BoolVar(&f.strict, "strict", false, "error if the dates are outside the history")
+}
+
+// dates returns the from and to dates.
+func (f *scenarioFlags) dates() (portfolio.Date, portfolio.Date, error) {
+	from, to := portfolio.Date(0), portfolio.MaxDate
+
+	var err error
+	if f.from != "" {
+		if from, err = portfolio.ParseDate(f.from); err != nil {
+			return 0, 0, fmt.Errorf("--from: %v", err)
+		}
+	}
+	if f.to != "" {
+		if to, err = portfolio.ParseDate(f.to); err != nil {
+			return 0, 0, fmt.Errorf("--to: %v", err)
+		}
+	}
+
+	return from, to, nil
+}
+
+// scenarios returns a scenario with the results calculated
+// for each --hold flag.
+func (f *scenarioFlags) scenarios() ([]*portfolio.StockScenario, error) {
+	if len(f.holds.lists) == 0 {
+		return nil, fmt.Errorf("no --hold flag")
+	}
+
+	from, to, err := f.dates()
+	if err != nil {
+		return nil, err
+	}
+
+	var scenarios []*portfolio.StockScenario
+	for _, hold := range f.holds.lists {
+		sc := portfolio.NewStockScenario(from, to)
+		sc.StrictDates = f.strict
+
+		for _, h := range hold {
+			stock, err := loadStock(h.ticker)
+			if err != nil {
+				return nil, err
+			}
+			if err := sc.AddStock(stock, h.weight); err != nil {
+				return nil, fmt.Errorf("%s: %v", h.ticker, err)
+			}
+		}
+
+		if err := sc.CalcResults(f.amount); err != nil {
+			return nil, fmt.Errorf("%s: %v", holdString(sc), err)
+		}
+		scenarios = append(scenarios, sc)
+	}
+
+	return scenarios, nil
+}
+
+// chartFlags are the flags which write an SVG chart.
+type chartFlags struct {
+	file  string
+	kind  string
+	width int
+}
+
+func (f *chartFlags) add(fs *flag.FlagSet) {
+	fs.StringVar(&f.file, "chart", "", "write an SVG chart to `file`")
+	fs.StringVar(&f.kind, "chart-type", "growth", "kind of chart: growth, log, drawdown, allocation or annual")
+	fs.IntVar(&f.width, "chart-width", 800, "chart width in pixels, with a height of half the width")
+}
+
+// write writes the chart, if the --chart flag was given,
+// using the WriteChart method of a scenario or comparison.
+func (f *chartFlags) write(chart func(io.Writer, portfolio.ChartKind, portfolio.ChartOptions) error) error {
+	if f.file == "" {
+		return nil
+	}
+
+	kind, err := portfolio.ParseChartKind(f.kind)
+	if err != nil {
+		return err
+	}
+
+	opts := portfolio.ChartOptions{Width: f.width, Height: f.width / 2}
+	return writeFile(f.file, func(w io.Writer) error {
+		return chart(w, kind, opts)
+	})
+}
+
+// stocks caches the stocks read, since several scenarios
+// often hold the same tickers. stocksMu guards stocks for
+// the server's concurrent requests.
+var (
+	stocks   = map[string]*portfolio.Stock{}
+	stocksMu sync.Mutex
+)
+
+// loadStock returns the stock for a ticker with its history.
+func loadStock(ticker string) (*portfolio.Stock, error) {
+	stocksMu.Lock()
+	defer stocksMu.Unlock()
+
+	if stock, ok := stocks[ticker]; ok {
+		return stock, nil
+	}
+
+	stock, err := portfolio.NewStock(ticker)
+	if err != nil {
+		return nil, fmt.Errorf("no history for %s: %v", ticker, err)
+	}
+	stocks[ticker] = stock
+	return stock, nil
+}
+
+// holding is a ticker and its weight.
+type holding struct {
+	ticker string
+	weight float64
+}
+
+// holdList is a flag.Value with the holdings of one
+// or, if multiple is true, more portfolios.
+type holdList struct {
+	lists    [][]holding
+	multiple bool
+}
+
+func (h *holdList) String() string {
+	var s []string
+	for _, list := range h.lists {
+		var items []string
+		for _, item := range list {
+			items = append(items, fmt.Sprintf("%s=%g", item.ticker, item.weight))
+		}
+		s = append(s, strings.Join(items, ","))
+	}
+	return strings.Join(s, " ")
+}
+
+func (h *holdList) Set(value string) error {
+	if len(h.lists) > 0 && !h.multiple {
+		return fmt.Errorf("only one --hold allowed")
+	}
+
+	pairs, err := splitPairs(value)
+	if err != nil {
+		return err
+	}
+
+	var list []holding
+	for _, pair := range pairs {
+		weight, err := strconv.ParseFloat(pair[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid weight for %s", pair[0])
+		}
+		list = append(list, holding{ticker: strings.ToUpper(pair[0]), weight: weight})
+	}
+
+	h.lists = append(h.lists, list)
+	return nil
+}
+
+// splitPairs splits a list such as "a=1,b=2" into name and value pairs.
+func splitPairs(list string) ([][2]string, error) {
+	var pairs [][2]string
+	if list == "" {
+		return pairs, nil
+	}
+
+	for _, item := range strings.Split(list, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%q is not name=value", item)
+		}
+		pairs = append(pairs, [2]string{strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])})
+	}
+
+	return pairs, nil
+}
+
+// holdString returns the tickers and weights of a scenario.
+func holdString(sc *portfolio.StockScenario) string {
+	var items []string
+	for i, stock := range sc.Stocks {
+		items = append(items, fmt.Sprintf("%s=%g", stock.Ticker, sc.PctHolding[i]))
+	}
+	return strings.Join(items, ",")
+}
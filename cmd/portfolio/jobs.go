@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	portfolio "github.com/ddgarrett/PortfolioAnalysis"
+)
+
+// maxJobs is the number of finished jobs retained,
+// after which the oldest are dropped.
+const maxJobs = 100
+
+// errQueueFull is returned when a job is submitted
+// while the queue is full.
+var errQueueFull = errors.New("job queue is full")
+
+// jobStatus is the state of a job.
+type jobStatus string
+
+const (
+	jobQueued    jobStatus = "queued"
+	jobRunning   jobStatus = "running"
+	jobDone      jobStatus = "done"
+	jobFailed    jobStatus = "failed"
+	jobCancelled jobStatus = "cancelled"
+)
+
+// job runs the backtests of one or more scenarios in the background.
+// Progress is the fraction of the scenarios run, from 0 to 1, and
+// Results the backtest of each scenario once the job is done.
+type job struct {
+	ID       string      `json:"id"`
+	Status   jobStatus   `json:"status"`
+	Progress float64     `json:"progress"`
+	Error    string      `json:"error,omitempty"`
+	Created  time.Time   `json:"created"`
+	Started  *time.Time  `json:"started,omitempty"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	Results  []*backtest `json:"results,omitempty"`
+
+	scenarios []*portfolio.ScenarioDef
+	cancel    context.CancelFunc
+}
+
+// jobQueue runs jobs with a bounded number of workers
+// and retains the jobs for their results to be retrieved.
+type jobQueue struct {
+	queue chan *job
+	ctx   context.Context
+	stop  context.CancelFunc
+	wg    sync.WaitGroup
+
+	// jobs are the jobs by ID, and order the
+	// IDs from oldest to newest. mu guards the
+	// jobs map and the fields of each job.
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []string
+}
+
+// newJobQueue starts a job queue with a number of workers and
+// room for a number of jobs waiting to run.
+func newJobQueue(workers, size int) *jobQueue {
+	q := &jobQueue{queue: make(chan *job, size), jobs: make(map[string]*job)}
+	q.ctx, q.stop = context.WithCancel(context.Background())
+
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// close cancels the running jobs and waits for the workers to stop.
+func (q *jobQueue) close() {
+	q.stop()
+	q.wg.Wait()
+}
+
+// submit queues a job to run the scenarios.
+func (q *jobQueue) submit(scenarios []*portfolio.ScenarioDef) (*job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	j := &job{ID: id, Status: jobQueued, Created: time.Now(), scenarios: scenarios}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case q.queue <- j:
+	default:
+		return nil, errQueueFull
+	}
+
+	q.jobs[id] = j
+	q.order = append(q.order, id)
+	q.dropFinished()
+	return j, nil
+}
+
+// dropFinished drops the oldest finished jobs while
+// more than maxJobs jobs are retained.
+func (q *jobQueue) dropFinished() {
+	for i := 0; i < len(q.order) && len(q.order) > maxJobs; {
+		if j := q.jobs[q.order[i]]; j.Finished != nil {
+			delete(q.jobs, j.ID)
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// get returns a copy of a job, without its results unless withResults
+// is true, or nil if there is no such job.
+func (q *jobQueue) get(id string, withResults bool) *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil
+	}
+
+	c := *j
+	if !withResults {
+		c.Results = nil
+	}
+	return &c
+}
+
+// list returns a copy of each job, oldest first, without their results.
+func (q *jobQueue) list() []*job {
+	q.mu.Lock()
+	ids := append([]string(nil), q.order...)
+	q.mu.Unlock()
+
+	jobs := []*job{}
+	for _, id := range ids {
+		if j := q.get(id, false); j != nil {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+// cancel cancels a queued or running job. It returns false
+// if there is no such job or it has already finished.
+func (q *jobQueue) cancel(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, ok := q.jobs[id]
+	if !ok || j.Finished != nil {
+		return false
+	}
+
+	if j.cancel != nil {
+		j.cancel()
+	} else {
+		q.finish(j, jobCancelled, nil)
+	}
+	return true
+}
+
+// work runs queued jobs until the queue is closed.
+func (q *jobQueue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case j := <-q.queue:
+			q.run(j)
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// run runs a job's scenarios, unless it was cancelled while queued.
+func (q *jobQueue) run(j *job) {
+	ctx, cancel := context.WithCancel(q.ctx)
+	defer cancel()
+
+	q.mu.Lock()
+	if j.Status != jobQueued {
+		q.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	j.Status, j.Started, j.cancel = jobRunning, &now, cancel
+	q.mu.Unlock()
+
+	var results []*backtest
+	for i, def := range j.scenarios {
+		progress := func(done float64) {
+			q.mu.Lock()
+			j.Progress = (float64(i) + done) / float64(len(j.scenarios))
+			q.mu.Unlock()
+		}
+
+		sc, bench, err := def.RunContext(ctx, progress)
+		if err != nil {
+			q.mu.Lock()
+			if ctx.Err() != nil {
+				q.finish(j, jobCancelled, nil)
+			} else {
+				q.finish(j, jobFailed, fmt.Errorf("scenario %d: %v", i, err))
+			}
+			q.mu.Unlock()
+			return
+		}
+
+		// the scenarios are only retained for backtests with charts
+		bt := newBacktest(def, sc, bench)
+		bt.scenarios = nil
+		results = append(results, bt)
+	}
+
+	q.mu.Lock()
+	j.Results = results
+	q.finish(j, jobDone, nil)
+	q.mu.Unlock()
+}
+
+// finish sets the final status of a job. q.mu must be held.
+func (q *jobQueue) finish(j *job, status jobStatus, err error) {
+	now := time.Now()
+	j.Status, j.Finished, j.cancel = status, &now, nil
+	if status == jobDone {
+		j.Progress = 1
+	}
+	if err != nil {
+		j.Error = err.Error()
+	}
+}
+
+// handleJobs handles GET /jobs, listing the jobs, and POST /jobs,
+// submitting a job to run the scenario, or JSON array of scenarios,
+// in the request body.
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		writeJSON(w, http.StatusOK, s.jobs.list())
+		return
+	}
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	scenarios, ok := readScenarios(w, r, true)
+	if !ok {
+		return
+	}
+
+	j, err := s.jobs.submit(scenarios)
+	if err == errQueueFull {
+		w.Header().Set("Retry-After", "60")
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, s.jobs.get(j.ID, false))
+}
+
+// handleJob handles GET /jobs/{id}, returning the job with its
+// results once done, and DELETE /jobs/{id}, cancelling the job.
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodDelete:
+		if !s.jobs.cancel(id) && s.jobs.get(id, false) != nil {
+			writeError(w, http.StatusConflict, fmt.Errorf("job %q has finished", id))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	j := s.jobs.get(id, true)
+	if j == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job %q", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeJobs(t *testing.T) {
+	s := newServer(1, 10)
+	defer s.close()
+
+	scenarios := `[
+  {"name": "stocks", "from": "2016-01-01", "to": "2020-12-31",
+   "holdings": [{"ticker": "FXAIX", "weight": 1}]},
+  {"name": "bonds", "from": "2016-01-01", "to": "2020-12-31",
+   "holdings": [{"ticker": "FXNAX", "weight": 1}]}
+]`
+
+	var j job
+	w := request(t, s, "POST", "/jobs", scenarios, &j)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("Location") != "/jobs/"+j.ID || j.ID == "" {
+		t.Errorf("location %q for ID %q", w.Header().Get("Location"), j.ID)
+	}
+
+	for deadline := time.Now().Add(30 * time.Second); j.Status == jobQueued || j.Status == jobRunning; {
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", j.ID, j.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+		request(t, s, "GET", "/jobs/"+j.ID, "", &j)
+	}
+	if j.Status != jobDone || j.Progress != 1 || len(j.Results) != 2 {
+		t.Fatalf("job %s %s with progress %f and %d results", j.ID, j.Status, j.Progress, len(j.Results))
+	}
+	if j.Results[0].Summary.Name != "stocks" || j.Results[1].Summary.Name != "bonds" {
+		t.Errorf("results %q and %q", j.Results[0].Summary.Name, j.Results[1].Summary.Name)
+	}
+
+	var e apiError
+	if w := request(t, s, "DELETE", "/jobs/"+j.ID, "", &e); w.Code != http.StatusConflict {
+		t.Errorf("status %d cancelling finished job", w.Code)
+	}
+	if w := request(t, s, "GET", "/jobs/none", "", &e); w.Code != http.StatusNotFound {
+		t.Errorf("status %d for unknown job", w.Code)
+	}
+	if w := request(t, s, "POST", "/jobs", `[{"holdings": []}]`, &e); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d for invalid scenario", w.Code)
+	}
+
+	var jobs []job
+	request(t, s, "GET", "/jobs", "", &jobs)
+	if len(jobs) != 1 || jobs[0].ID != j.ID || jobs[0].Results != nil {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+}
+
+func TestServeJobsQueue(t *testing.T) {
+	// without workers, jobs stay queued
+	s := newServer(0, 1)
+	defer s.close()
+
+	scenario := `{"holdings": [{"ticker": "FXAIX", "weight": 1}]}`
+
+	var queued job
+	if w := request(t, s, "POST", "/jobs", scenario, &queued); w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var e apiError
+	w := request(t, s, "POST", "/jobs", scenario, &e)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status %d submitting to full queue", w.Code)
+	}
+
+	var cancelled job
+	if w := request(t, s, "DELETE", "/jobs/"+queued.ID, "", &cancelled); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if cancelled.Status != jobCancelled || cancelled.Finished == nil {
+		t.Errorf("job %s %s after cancelling", cancelled.ID, cancelled.Status)
+	}
+	if w := request(t, s, "DELETE", "/jobs/"+queued.ID, "", &e); w.Code != http.StatusConflict {
+		t.Errorf("status %d cancelling job twice", w.Code)
+	}
+}
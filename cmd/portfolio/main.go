@@ -1,19 +1,62 @@
+// Command portfolio runs backtests of stock scenarios and manages
+// the stock history they use.
+//
+// Usage:
+//
+//	portfolio <command> [flags]
+//
+// Stock history is read from the data/ directory.
+// Run "portfolio <command> -h" for the flags of a command.
 package main
 
 import (
-	"io"
-	"log"
-	"net/http"
+	"fmt"
+	"os"
 )
 
+// command is a subcommand of the CLI.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"backtest", "run a backtest of one portfolio and print a summary", runBacktest},
+	{"run", "run the scenarios in scenario files or directories", runRun},
+	{"compare", "run backtests of several portfolios and compare them", runCompare},
+	{"stats", "print the return and risk of tickers", runStats},
+	{"data", "list the tickers with history or show the history of a ticker", runData},
+	{"trades", "print the trades to rebalance the accounts in a positions export", runTrades},
+	{"serve", "serve the REST API and browser dashboard for running backtests", runServe},
+}
+
 func main() {
-	// Hello world, the web server
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
 
-	helloHandler := func(w http.ResponseWriter, req *http.Request) {
-		io.WriteString(w, "Hello, world!\n")
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "portfolio %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
 	}
 
-	http.HandleFunc("/hello", helloHandler)
-	log.Println("Listening for requests at http://localhost:8000/hello")
-	log.Fatal(http.ListenAndServe(":8000", nil))
+	if os.Args[1] != "help" && os.Args[1] != "-h" && os.Args[1] != "--help" {
+		fmt.Fprintf(os.Stderr, "portfolio: unknown command %q\n", os.Args[1])
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: portfolio <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	portfolio "github.com/ddgarrett/PortfolioAnalysis"
+)
+
+func runRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	check := fs.Bool("check", false, "only validate the scenario files")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: portfolio run [flags] FILE|DIR...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no scenario files")
+	}
+
+	var files []string
+	for _, arg := range fs.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		dirFiles, err := portfolio.ScenarioFiles(arg)
+		if err != nil {
+			return err
+		}
+		files = append(files, dirFiles...)
+	}
+
+	var results []portfolio.BatchResult
+	if *check {
+		for _, file := range files {
+			_, err := portfolio.ReadScenarioFile(file)
+			results = append(results, portfolio.BatchResult{File: file, Err: err})
+		}
+	} else {
+		results = portfolio.RunScenarioFiles(files)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintln(os.Stderr, r.Err)
+			failed++
+		}
+	}
+
+	if !*check && failed < len(results) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "Name\tFrom\tTo\tEnd amount\tCAGR\tVolatility\tBenchmark CAGR\t")
+		for _, r := range results {
+			if r.Err != nil {
+				continue
+			}
+			sc := r.Scenario
+			bench := ""
+			if r.Benchmark != nil {
+				bench = fmt.Sprintf("%.2f%%", r.Benchmark.CAGR*100)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.2f%%\t%.2f%%\t%s\t\n", r.Def.Name,
+				sc.StartDate, sc.EndDate, sc.EndAmt, sc.CAGR*100, sc.Volatility()*100, bench)
+		}
+		w.Flush()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scenario files failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	portfolio "github.com/ddgarrett/PortfolioAnalysis"
+)
+
+const (
+	// maxBodySize is the largest request body accepted.
+	maxBodySize = 1 << 20
+
+	// maxBacktests is the number of backtests retained,
+	// after which the oldest are dropped.
+	maxBacktests = 100
+
+	// shutdownTimeout is how long requests in progress
+	// have to finish when the server is stopped.
+	shutdownTimeout = 30 * time.Second
+
+	// minChartWidth and maxChartWidth limit the width
+	// of a chart, in pixels, which is twice its height.
+	minChartWidth = 200
+	maxChartWidth = 2000
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8000", "address to listen on")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of jobs run at once")
+	queue := fs.Int("queue", 100, "number of jobs waiting to run before new jobs are refused")
+	fs.Parse(args)
+
+	if *workers < 1 || *queue < 0 {
+		return fmt.Errorf("--workers must be at least 1 and --queue at least 0")
+	}
+
+	s := newServer(*workers, *queue)
+	defer s.close()
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	log.Printf("listening for requests at %s", *addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// server is the REST API for running backtests,
+// and the browser dashboard using it.
+type server struct {
+	mux  *http.ServeMux
+	jobs *jobQueue
+	web  http.Handler
+
+	// backtests are the backtests run, by ID, and
+	// order the IDs from oldest to newest.
+	mu        sync.Mutex
+	backtests map[string]*backtest
+	order     []string
+}
+
+// backtest is a backtest run by the server.
+type backtest struct {
+	ID        string                     `json:"id"`
+	Scenario  *portfolio.ScenarioDef     `json:"scenario"`
+	Summary   portfolio.ScenarioSummary  `json:"summary"`
+	Benchmark *portfolio.ScenarioSummary `json:"benchmark,omitempty"`
+	Results   []portfolio.ResultRow      `json:"results"`
+
+	// scenarios are the scenario and benchmark run,
+	// retained for their charts and report.
+	scenarios []*portfolio.StockScenario
+}
+
+// newBacktest returns the backtest of a scenario definition
+// run, with its benchmark if it has one.
+func newBacktest(def *portfolio.ScenarioDef, sc, bench *portfolio.StockScenario) *backtest {
+	bt := &backtest{Scenario: def, Summary: sc.Summary(), Results: sc.Rows(),
+		scenarios: []*portfolio.StockScenario{sc}}
+	if bench != nil {
+		summary := bench.Summary()
+		bt.Benchmark = &summary
+		bt.scenarios = append(bt.scenarios, bench)
+	}
+	return bt
+}
+
+// tickerInfo is a ticker and the dates of its history.
+type tickerInfo struct {
+	Ticker string         `json:"ticker"`
+	From   portfolio.Date `json:"from"`
+	To     portfolio.Date `json:"to"`
+	Days   int            `json:"days"`
+}
+
+// historyEntry is a day of a ticker's history.
+type historyEntry struct {
+	Date         portfolio.Date  `json:"date"`
+	Close        portfolio.Price `json:"close"`
+	Dividend     portfolio.Price `json:"dividend"`
+	Distribution portfolio.Price `json:"distribution"`
+}
+
+// apiError is the body of an error response. Details are
+// the errors in a scenario, with their line numbers.
+type apiError struct {
+	Error   string                      `json:"error"`
+	Details []portfolio.ValidationError `json:"details,omitempty"`
+}
+
+// newServer returns a server with its routes, running jobs with a
+// number of workers and room for a number of queued jobs.
+func newServer(workers, queue int) *server {
+	s := &server{
+		mux:       http.NewServeMux(),
+		jobs:      newJobQueue(workers, queue),
+		web:       http.FileServer(http.FS(webRoot)),
+		backtests: make(map[string]*backtest),
+	}
+	s.mux.HandleFunc("/tickers", s.handleTickers)
+	s.mux.HandleFunc("/tickers/", s.handleHistory)
+	s.mux.HandleFunc("/backtests", s.handleBacktests)
+	s.mux.HandleFunc("/backtests/", s.handleBacktest)
+	s.mux.HandleFunc("/jobs", s.handleJobs)
+	s.mux.HandleFunc("/jobs/", s.handleJob)
+	s.mux.HandleFunc("/", s.handleWeb)
+	return s
+}
+
+// close cancels the running jobs.
+func (s *server) close() {
+	s.jobs.close()
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleTickers handles GET /tickers, listing the tickers with history.
+func (s *server) handleTickers(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	tickers, err := dataTickers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	infos := []tickerInfo{}
+	for _, ticker := range tickers {
+		stock, err := loadStock(ticker)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		history := stock.History
+		infos = append(infos, tickerInfo{ticker, history[0].Date, history[len(history)-1].Date, len(history)})
+	}
+
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// handleHistory handles GET /tickers/{ticker}/history, with
+// optional from and to query parameters.
+func (s *server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/tickers/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "history" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	var f scenarioFlags
+	f.from, f.to = r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	from, to, err := f.dates()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ticker := strings.ToUpper(parts[0])
+	if !validTicker(ticker) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ticker %q", parts[0]))
+		return
+	}
+
+	stock, err := loadStock(ticker)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	history := []historyEntry{}
+	for _, h := range stock.History {
+		if h.Date >= from && h.Date <= to {
+			history = append(history, historyEntry{h.Date, h.Close, h.Dividend, h.Distribution})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Ticker  string         `json:"ticker"`
+		History []historyEntry `json:"history"`
+	}{ticker, history})
+}
+
+// handleBacktests handles POST /backtests, running the scenario in the
+// request body, in the JSON scenario file format, and returning its results.
+func (s *server) handleBacktests(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	def, ok := readScenario(w, r)
+	if !ok {
+		return
+	}
+
+	sc, bench, err := def.RunContext(r.Context(), nil)
+	if err != nil {
+		writeScenarioError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	bt := newBacktest(def, sc, bench)
+	if err := s.addBacktest(bt); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", "/backtests/"+bt.ID)
+	writeJSON(w, http.StatusCreated, bt)
+}
+
+// handleBacktest handles GET /backtests/{id}, and GET
+// /backtests/{id}/chart and /backtests/{id}/report.
+func (s *server) handleBacktest(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/backtests/"), "/")
+	if len(parts) > 2 || len(parts) == 2 && parts[1] != "chart" && parts[1] != "report" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	id := parts[0]
+	s.mu.Lock()
+	bt, ok := s.backtests[id]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no backtest %q", id))
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		writeJSON(w, http.StatusOK, bt)
+	case parts[1] == "chart":
+		writeChart(w, r, bt)
+	default:
+		writeBody(w, "text/html; charset=utf-8", func(w io.Writer) error {
+			return portfolio.WriteReport(w, portfolio.ReportOptions{}, bt.scenarios...)
+		})
+	}
+}
+
+// writeChart writes the SVG chart of a backtest with the type and
+// width query parameters, comparing it to its benchmark except for
+// the allocation chart.
+func writeChart(w http.ResponseWriter, r *http.Request, bt *backtest) {
+	q := r.URL.Query()
+
+	kind := portfolio.GrowthChart
+	if t := q.Get("type"); t != "" {
+		var err error
+		if kind, err = portfolio.ParseChartKind(t); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	var opts portfolio.ChartOptions
+	if width := q.Get("width"); width != "" {
+		n, err := strconv.Atoi(width)
+		if err != nil || n < minChartWidth || n > maxChartWidth {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("width must be from %d to %d", minChartWidth, maxChartWidth))
+			return
+		}
+		opts.Width, opts.Height = n, n/2
+	}
+
+	writeBody(w, "image/svg+xml", func(w io.Writer) error {
+		if kind == portfolio.AllocationChart {
+			return bt.scenarios[0].WriteChart(w, kind, opts)
+		}
+		c, err := portfolio.Compare(bt.scenarios...)
+		if err != nil {
+			return err
+		}
+		return c.WriteChart(w, kind, opts)
+	})
+}
+
+// addBacktest assigns the backtest an ID and retains it,
+// dropping the oldest backtest if there are maxBacktests.
+func (s *server) addBacktest(bt *backtest) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	bt.ID = id
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.order) >= maxBacktests {
+		delete(s.backtests, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.backtests[id] = bt
+	s.order = append(s.order, id)
+	return nil
+}
+
+// readScenario reads and validates the scenario in a request body,
+// writing an error response if it is not valid.
+func readScenario(w http.ResponseWriter, r *http.Request) (*portfolio.ScenarioDef, bool) {
+	defs, ok := readScenarios(w, r, false)
+	if !ok {
+		return nil, false
+	}
+	return defs[0], true
+}
+
+// readScenarios reads and validates the scenario, or if multiple is
+// true the JSON array of scenarios, in a request body, writing an
+// error response if any is not valid.
+func readScenarios(w http.ResponseWriter, r *http.Request, multiple bool) ([]*portfolio.ScenarioDef, bool) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return nil, false
+	}
+
+	if !json.Valid(body) {
+		writeError(w, http.StatusBadRequest, errors.New("request body is not valid JSON"))
+		return nil, false
+	}
+
+	bodies := []json.RawMessage{body}
+	if multiple && bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		if err := json.Unmarshal(body, &bodies); err != nil || len(bodies) == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("request body is not an array of scenarios"))
+			return nil, false
+		}
+	}
+
+	var defs []*portfolio.ScenarioDef
+	for i, body := range bodies {
+		file := "backtest"
+		if len(bodies) > 1 {
+			file = fmt.Sprintf("scenarios[%d]", i)
+		}
+
+		def, err := portfolio.ParseScenario(file, body)
+		if err != nil {
+			writeScenarioError(w, err, http.StatusBadRequest)
+			return nil, false
+		}
+		def.LoadStock = loadStock
+
+		// tickers name files in dataDir, so must not contain a path
+		tickers := []string{def.Benchmark}
+		for _, h := range def.Holdings {
+			tickers = append(tickers, h.Ticker)
+		}
+		for i, ticker := range tickers {
+			if (i > 0 || ticker != "") && !validTicker(ticker) {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%s: invalid ticker %q", file, ticker))
+				return nil, false
+			}
+		}
+
+		defs = append(defs, def)
+	}
+	return defs, true
+}
+
+// writeScenarioError writes an error from parsing or running a
+// scenario. Validation errors are a bad request and other errors
+// have the status given.
+func writeScenarioError(w http.ResponseWriter, err error, status int) {
+	var verrs portfolio.ValidationErrors
+	if !errors.As(err, &verrs) {
+		writeError(w, status, err)
+		return
+	}
+
+	writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid scenario", Details: verrs})
+}
+
+// allowMethod returns true if the request method is allowed,
+// and otherwise writes a method not allowed response.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || (method == http.MethodGet && r.Method == http.MethodHead) {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+// writeJSON writes a response with a JSON body, or an
+// internal server error if v cannot be encoded.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(v); err != nil {
+		log.Printf("encoding response: %v", err)
+		status = http.StatusInternalServerError
+		w.Header().Del("Location")
+		b.Reset()
+		json.NewEncoder(&b).Encode(apiError{Error: fmt.Sprintf("encoding response: %v", err)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := b.WriteTo(w); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+// writeBody writes a response with the content type, and the body
+// written by write, or an error response if write fails.
+func writeBody(w http.ResponseWriter, contentType string, write func(io.Writer) error) {
+	var b bytes.Buffer
+	if err := write(&b); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := b.WriteTo(w); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+// validTicker returns true if a ticker only contains
+// letters, digits, dots and dashes.
+func validTicker(ticker string) bool {
+	if ticker == "" || len(ticker) > 10 {
+		return false
+	}
+	for _, c := range ticker {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// newID returns a random ID.
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
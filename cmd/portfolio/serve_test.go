@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the tests from the repository root,
+// where the data directory is.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// request sends a request to the server and decodes the JSON response.
+func request(t *testing.T, s *server, method, path, body string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: content type %q", method, path, ct)
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return w
+}
+
+func TestServeTickers(t *testing.T) {
+	s := newServer(1, 10)
+	defer s.close()
+
+	var tickers []tickerInfo
+	if w := request(t, s, "GET", "/tickers", "", &tickers); w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if len(tickers) != 5 || tickers[0].Ticker != "AGG" || tickers[0].Days == 0 {
+		t.Errorf("unexpected tickers %+v", tickers)
+	}
+
+	var history struct {
+		Ticker  string
+		History []historyEntry
+	}
+	w := request(t, s, "GET", "/tickers/fxaix/history?from=2020-01-01&to=2020-01-31", "", &history)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if history.Ticker != "FXAIX" || len(history.History) != 21 {
+		t.Errorf("%s history has %d days, expected 21", history.Ticker, len(history.History))
+	}
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{"POST", "/tickers", http.StatusMethodNotAllowed},
+		{"GET", "/tickers/NONE/history", http.StatusNotFound},
+		{"GET", "/tickers/FXAIX_div/history", http.StatusBadRequest},
+		{"GET", "/tickers/FXAIX/history?from=never", http.StatusBadRequest},
+		{"GET", "/tickers/FXAIX", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		var e apiError
+		if w := request(t, s, test.method, test.path, "", &e); w.Code != test.status || e.Error == "" {
+			t.Errorf("%s %s: status %d %q, expected %d", test.method, test.path, w.Code, e.Error, test.status)
+		}
+	}
+}
+
+func TestServeBacktests(t *testing.T) {
+	s := newServer(1, 10)
+	defer s.close()
+
+	scenario := `{
+  "name": "60/40",
+  "from": "2016-01-01",
+  "to": "2020-12-31",
+  "holdings": [
+    {"ticker": "FXAIX", "weight": 0.6},
+    {"ticker": "fxnax", "weight": 0.4}
+  ],
+  "benchmark": "FXAIX"
+}`
+
+	var bt backtest
+	w := request(t, s, "POST", "/backtests", scenario, &bt)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("Location") != "/backtests/"+bt.ID || bt.ID == "" {
+		t.Errorf("location %q for ID %q", w.Header().Get("Location"), bt.ID)
+	}
+	if bt.Summary.Name != "60/40" || bt.Benchmark == nil || len(bt.Results) == 0 {
+		t.Errorf("unexpected backtest %+v", bt.Summary)
+	}
+
+	var got backtest
+	if w := request(t, s, "GET", "/backtests/"+bt.ID, "", &got); w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if got.Summary.EndAmt != bt.Summary.EndAmt || len(got.Results) != len(bt.Results) {
+		t.Errorf("backtest %s changed", bt.ID)
+	}
+
+	var e apiError
+	if w := request(t, s, "GET", "/backtests/none", "", &e); w.Code != http.StatusNotFound {
+		t.Errorf("status %d for unknown backtest", w.Code)
+	}
+
+	pages := []struct {
+		path, contentType, contains string
+	}{
+		{"/chart", "image/svg+xml", "FXAIX"},
+		{"/chart?type=allocation&width=400", "image/svg+xml", `width="400"`},
+		{"/report", "text/html; charset=utf-8", "Monthly returns"},
+	}
+	for _, page := range pages {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/backtests/"+bt.ID+page.path, nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != page.contentType {
+			t.Errorf("%s: status %d, content type %q", page.path, w.Code, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), page.contains) {
+			t.Errorf("%s: missing %q", page.path, page.contains)
+		}
+	}
+
+	for _, path := range []string{"/chart?type=pie", "/chart?width=10", "/trades"} {
+		var e apiError
+		if w := request(t, s, "GET", "/backtests/"+bt.ID+path, "", &e); w.Code == http.StatusOK || e.Error == "" {
+			t.Errorf("%s: status %d", path, w.Code)
+		}
+	}
+
+	tests := []struct {
+		body   string
+		status int
+		line   int
+	}{
+		{`{"holdings": [`, http.StatusBadRequest, 0},
+		{`{"holdings": [{"ticker": "FXAIX", "weight": 2}]}`, http.StatusBadRequest, 1},
+		{"{\n\"holdings\": [{\"ticker\": \"FXAIX\", \"weight\": 1}],\n\"colour\": 1\n}", http.StatusBadRequest, 3},
+		{`{"holdings": [{"ticker": "../x", "weight": 1}]}`, http.StatusBadRequest, 0},
+		{`{"holdings": [{"ticker": "NONE", "weight": 1}]}`, http.StatusBadRequest, 1},
+		{`{"from": "2030-01-01", "holdings": [{"ticker": "FXAIX", "weight": 1}]}`, http.StatusUnprocessableEntity, 0},
+	}
+	for _, test := range tests {
+		var e apiError
+		w := request(t, s, "POST", "/backtests", test.body, &e)
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, expected %d: %s", test.body, w.Code, test.status, w.Body)
+		}
+		if test.line > 0 && (len(e.Details) == 0 || e.Details[0].Line != test.line) {
+			t.Errorf("%s: details %+v, expected line %d", test.body, e.Details, test.line)
+		}
+	}
+}
+
+func TestServeWeb(t *testing.T) {
+	s := newServer(1, 10)
+	defer s.close()
+
+	pages := []struct {
+		path, contains string
+	}{
+		{"/", "<title>Portfolio backtest</title>"},
+		{"/app.js", "/backtests"},
+		{"/app.css", "font-family"},
+	}
+	for _, page := range pages {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", page.path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), page.contains) {
+			t.Errorf("%s: status %d, missing %q", page.path, w.Code, page.contains)
+		}
+	}
+
+	var e apiError
+	if w := request(t, s, "GET", "/none.html", "", &e); w.Code != http.StatusNotFound {
+		t.Errorf("status %d for unknown file", w.Code)
+	}
+	if w := request(t, s, "POST", "/", "", &e); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status %d posting to dashboard", w.Code)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Location", "/backtests/1")
+	writeJSON(w, http.StatusCreated, math.NaN())
+
+	var e apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Code != http.StatusInternalServerError || e.Error == "" || w.Header().Get("Location") != "" {
+		t.Errorf("status %d %q encoding NaN", w.Code, e.Error)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	portfolio "github.com/ddgarrett/PortfolioAnalysis"
+)
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	f := scenarioFlags{amount: 10000}
+	f.holds.multiple = true
+	f.addDates(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: portfolio stats [flags] TICKER...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no tickers")
+	}
+
+	// each ticker is held by itself
+	for _, ticker := range fs.Args() {
+		if err := f.holds.Set(strings.ToUpper(ticker) + "=1"); err != nil {
+			return err
+		}
+	}
+
+	scenarios, err := f.scenarios()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Ticker\tFrom\tTo\tCAGR\tVolatility\tBest day\tWorst day\t")
+	for _, sc := range scenarios {
+		best, worst := bestWorst(sc)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f%%\t%.2f%%\t%.2f%%\t%.2f%%\t\n", sc.Stocks[0].Ticker,
+			sc.StartDate, sc.EndDate, sc.CAGR*100, sc.Volatility()*100, best*100, worst*100)
+	}
+	return w.Flush()
+}
+
+// bestWorst returns the best and worst daily return.
+func bestWorst(sc *portfolio.StockScenario) (float64, float64) {
+	best, worst := 0.0, 0.0
+	for _, sr := range sc.Results[1:] {
+		if sr.PctChange > best {
+			best = sr.PctChange
+		}
+		if sr.PctChange < worst {
+			worst = sr.PctChange
+		}
+	}
+	return best, worst
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	portfolio "github.com/ddgarrett/PortfolioAnalysis"
+)
+
+// defaultTax is used to locate assets when -locate is set.
+var defaultTax = portfolio.TaxModel{QualifiedRate: .15, OrdinaryRate: .24, ShortTermRate: .24, LongTermRate: .15}
+
+func runTrades(args []string) error {
+	fs := flag.NewFlagSet("trades", flag.ExitOnError)
+	var holds holdList
+	positions := fs.String("positions", "", "positions CSV export")
+	format := fs.String("format", "fidelity", "positions export format, fidelity or schwab")
+	account := fs.String("account", "", "account for exports without an account column")
+	types := fs.String("types", "", "account types, such as \"Roth IRA=roth,IRA=ira\"; others are taxable")
+	deposit := fs.String("deposit", "", "cash to add to accounts, such as brokerage=5000")
+	date := fs.String("date", "", "date of the closes to use (default latest)")
+	minTrade := fs.Float64("min-trade", 0, "minimum trade amount")
+	whole := fs.Bool("whole", false, "trade whole shares only")
+	cashOnly := fs.Bool("cash-only", false, "only buy with cash, do not sell")
+	noTaxableSales := fs.Bool("no-taxable-sales", false, "do not sell in taxable accounts")
+	locate := fs.Bool("locate", false, "place stocks in accounts to minimize tax drag")
+	fs.Var(&holds, "hold", "target weight for each ticker, such as FXAIX=0.6,FXNAX=0.4")
+	fs.Parse(args)
+
+	if *positions == "" || len(holds.lists) == 0 {
+		fs.Usage()
+		return fmt.Errorf("--positions and --hold are required")
+	}
+
+	asOf := portfolio.DateOf(time.Now())
+	if *date != "" {
+		var err error
+		if asOf, err = portfolio.ParseDate(*date); err != nil {
+			return err
+		}
+	}
+
+	p, err := loadPortfolio(*positions, *format, *account, *types, asOf)
+	if err != nil {
+		return err
+	}
+
+	if err := setTargets(p, holds.lists[0]); err != nil {
+		return err
+	}
+
+	if err := addDeposits(p, *deposit); err != nil {
+		return err
+	}
+
+	if *locate {
+		p.Tax = &defaultTax
+	}
+
+	trades, err := p.Trades(asOf, portfolio.TradeOptions{
+		MinTrade:       portfolio.NewMoney(*minTrade),
+		WholeShares:    *whole,
+		CashOnly:       *cashOnly,
+		NoTaxableSales: *noTaxableSales,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Account\tTicker\tAction\tShares\tPrice\tAmount\t")
+	for _, t := range trades {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", t.Account, t.Ticker, t.Action, t.Shares, t.Price, t.Amount)
+	}
+	return w.Flush()
+}
+
+// loadPortfolio imports the positions in a file into accounts of the given types.
+func loadPortfolio(file, format, account, types string, date portfolio.Date) (*portfolio.Portfolio, error) {
+	var cols portfolio.ColumnMap
+	switch format {
+	case "fidelity":
+		cols = portfolio.FidelityPositions
+	case "schwab":
+		cols = portfolio.SchwabPositions
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+
+	p := portfolio.NewPortfolio(file)
+
+	pairs, err := splitPairs(types)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		var accountType portfolio.AccountType
+		switch strings.ToLower(pair[1]) {
+		case "taxable":
+			accountType = portfolio.Taxable
+		case "ira":
+			accountType = portfolio.TraditionalIRA
+		case "roth":
+			accountType = portfolio.Roth
+		default:
+			return nil, fmt.Errorf("unknown account type %s", pair[1])
+		}
+		if _, err := p.AddAccount(pair[0], accountType); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, p.ImportPositions(file, date, account, cols)
+}
+
+// setTargets adds the stocks and target weights to the portfolio.
+func setTargets(p *portfolio.Portfolio, hold []holding) error {
+	for _, h := range hold {
+		stock, err := loadStock(h.ticker)
+		if err != nil {
+			return err
+		}
+
+		if err := p.AddStock(stock, h.weight); err != nil {
+			return fmt.Errorf("%s: %v", h.ticker, err)
+		}
+	}
+
+	return nil
+}
+
+// addDeposits adds cash to accounts.
+func addDeposits(p *portfolio.Portfolio, deposit string) error {
+	pairs, err := splitPairs(deposit)
+	if err != nil {
+		return err
+	}
+
+	for _, pair := range pairs {
+		a := p.Account(pair[0])
+		if a == nil {
+			return fmt.Errorf("no account %s", pair[0])
+		}
+
+		amt, err := portfolio.ParseMoney(pair[1])
+		if err != nil {
+			return err
+		}
+		a.Cash += amt
+	}
+
+	return nil
+}
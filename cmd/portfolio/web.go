@@ -0,0 +1,47 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// webFiles are the files of the browser dashboard, which
+// uses the REST API to run backtests and show their results.
+//
+//go:embed web
+var webFiles embed.FS
+
+// webRoot is the web directory of webFiles.
+var webRoot = mustSub(webFiles, "web")
+
+// handleWeb handles GET of the dashboard's files, with / serving
+// index.html. Other paths are not found.
+func (s *server) handleWeb(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	if info, err := fs.Stat(webRoot, name); err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	s.web.ServeHTTP(w, r)
+}
+
+// mustSub returns the subtree of a file system at dir,
+// and panics if dir is not valid.
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,232 @@
+// The dashboard runs a backtest of the holdings entered with the
+// REST API, and shows its summary and charts.
+"use strict";
+
+var tickers = [];
+
+var $ = function (id) { return document.getElementById(id); };
+
+// api sends a request to the REST API and returns a promise of the
+// decoded JSON response, rejected with the message of an error response.
+function api(method, path, body) {
+  var init = { method: method, headers: {} };
+  if (body !== undefined) {
+    init.headers["Content-Type"] = "application/json";
+    init.body = JSON.stringify(body, null, 2);
+  }
+  return fetch(path, init).then(function (resp) {
+    return resp.json().then(function (v) {
+      if (resp.ok) {
+        return v;
+      }
+      var msg = v.error;
+      if (v.details) {
+        msg = v.details.map(function (d) { return d.message; }).join("\n");
+      }
+      throw new Error(msg);
+    });
+  });
+}
+
+function showError(err) {
+  $("error").textContent = err ? err.message : "";
+  $("error").hidden = !err;
+}
+
+// addHolding adds a row to the holdings table.
+function addHolding(ticker, weight) {
+  var row = document.createElement("tr");
+  var select = document.createElement("select");
+  tickers.forEach(function (t) {
+    select.add(new Option(t.ticker, t.ticker));
+  });
+  select.value = ticker;
+
+  var input = document.createElement("input");
+  input.type = "number";
+  input.min = "0";
+  input.max = "100";
+  input.step = "any";
+  input.value = weight;
+
+  var remove = document.createElement("button");
+  remove.type = "button";
+  remove.textContent = "Remove";
+  remove.onclick = function () {
+    row.remove();
+    update();
+  };
+
+  [select, input, document.createTextNode(""), remove].forEach(function (el) {
+    var cell = row.insertCell();
+    cell.appendChild(el);
+  });
+  select.onchange = update;
+  input.oninput = update;
+  $("holdings").tBodies[0].appendChild(row);
+  update();
+}
+
+// holdings returns the ticker and weight, from 0 to 1, of each holding.
+function holdings() {
+  return Array.prototype.map.call($("holdings").tBodies[0].rows, function (row) {
+    return {
+      ticker: row.cells[0].firstChild.value,
+      weight: Number(row.cells[1].firstChild.value) / 100
+    };
+  });
+}
+
+function tickerInfo(ticker) {
+  return tickers.filter(function (t) { return t.ticker === ticker; })[0];
+}
+
+// update shows the history of each holding, the total weight,
+// and the dates the holdings all have history for.
+function update() {
+  var from = "", to = "", total = 0, hs = holdings();
+  Array.prototype.forEach.call($("holdings").tBodies[0].rows, function (row, i) {
+    var h = hs[i], t = tickerInfo(h.ticker);
+    row.cells[2].textContent = t.from + " to " + t.to;
+    total += h.weight;
+    if (t.from > from) {
+      from = t.from;
+    }
+    if (to === "" || t.to < to) {
+      to = t.to;
+    }
+  });
+
+  $("total").textContent = "Total " + formatNumber(total * 100, 2) + "%";
+  $("total").className = Math.abs(total - 1) > 0.0001 ? "neg" : "";
+  $("range").textContent = from ? "History for all holdings from " + from + " to " + to : "";
+  $("from").min = $("to").min = from;
+  $("from").max = $("to").max = to;
+}
+
+// scenario returns the scenario to run, in the JSON scenario file format.
+function scenario() {
+  var hs = holdings();
+  var name = $("name").value.trim() || hs.map(function (h) {
+    return h.ticker + " " + formatNumber(h.weight * 100, 2) + "%";
+  }).join(", ");
+
+  var s = {
+    name: name,
+    from: $("from").value,
+    to: $("to").value,
+    amount: Number($("amount").value),
+    holdings: hs,
+    rebalance: { every: $("every").value },
+    benchmark: $("benchmark").value
+  };
+  if ($("band").value !== "") {
+    s.rebalance.band = Number($("band").value) / 100;
+  }
+  return s;
+}
+
+function run(event) {
+  event.preventDefault();
+  showError(null);
+  $("run").disabled = true;
+  $("run").textContent = "Running...";
+
+  api("POST", "/backtests", scenario()).then(showBacktest, showError).then(function () {
+    $("run").disabled = false;
+    $("run").textContent = "Run backtest";
+  });
+}
+
+// summaryRows are the rows of the summary table, each with
+// a function returning its value from a summary.
+var summaryRows = [
+  ["Start amount", function (s) { return formatMoney(s.start_amt); }],
+  ["End amount", function (s) { return formatMoney(s.end_amt); }],
+  ["Total return", function (s) { return formatPct(s.total_return); }],
+  ["CAGR", function (s) { return formatPct(s.cagr); }],
+  ["Volatility", function (s) { return formatPct(s.volatility); }],
+  ["Max drawdown", function (s) { return s.max_drawdown === undefined ? "" : formatPct(s.max_drawdown); }],
+  ["Income", function (s) { return formatMoney(s.income); }],
+  ["Net cash flow", function (s) { return formatMoney(s.net_cash_flow); }],
+  ["Trading costs", function (s) { return formatMoney(s.trading_costs); }]
+];
+
+// showBacktest shows the summary and charts of a backtest.
+function showBacktest(bt) {
+  var summaries = [bt.summary];
+  bt.summary.max_drawdown = maxDrawdown(bt.results);
+  if (bt.benchmark) {
+    summaries.push(bt.benchmark);
+  }
+
+  $("title").textContent = bt.summary.name;
+  $("period").textContent = bt.summary.start_date + " to " + bt.summary.end_date;
+
+  var head = $("summary").tHead, body = $("summary").tBodies[0];
+  head.innerHTML = body.innerHTML = "";
+  var row = head.insertRow();
+  row.appendChild(document.createElement("th"));
+  summaries.forEach(function (s) {
+    row.appendChild(document.createElement("th")).textContent = s.name;
+  });
+  summaryRows.forEach(function (r) {
+    var row = body.insertRow();
+    row.appendChild(document.createElement("th")).textContent = r[0];
+    summaries.forEach(function (s) {
+      var cell = row.insertCell(), value = r[1](s);
+      cell.textContent = value;
+      cell.className = value.charAt(0) === "-" ? "neg" : "";
+    });
+  });
+
+  var path = "/backtests/" + bt.id;
+  $("report").href = path + "/report";
+  $("json").href = path;
+  ["growth", "drawdown", "annual", "allocation"].forEach(function (type) {
+    $(type).src = path + "/chart?type=" + type;
+  });
+  $("results").hidden = false;
+}
+
+// maxDrawdown returns the largest decline from a peak in the daily results.
+function maxDrawdown(results) {
+  var growth = 1, peak = 1, max = 0;
+  results.forEach(function (r, i) {
+    if (i > 0) {
+      growth *= 1 + r.pct_change;
+    }
+    peak = Math.max(peak, growth);
+    max = Math.min(max, growth / peak - 1);
+  });
+  return max;
+}
+
+function formatNumber(n, digits) {
+  return n.toLocaleString("en-US", { minimumFractionDigits: digits, maximumFractionDigits: digits });
+}
+
+function formatMoney(n) {
+  return (n < 0 ? "-$" : "$") + formatNumber(Math.abs(n), 2);
+}
+
+function formatPct(n) {
+  return formatNumber(n * 100, 2) + "%";
+}
+
+api("GET", "/tickers").then(function (ts) {
+  tickers = ts;
+  ts.forEach(function (t) {
+    $("benchmark").add(new Option(t.ticker, t.ticker));
+  });
+  if (ts.length > 0) {
+    addHolding(ts[0].ticker, 100);
+  }
+}, showError);
+
+$("add").onclick = function () {
+  if (tickers.length > 0) {
+    addHolding(tickers[0].ticker, 0);
+  }
+};
+$("scenario").onsubmit = run;
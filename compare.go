@@ -0,0 +1,273 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// tradingDays is the number of trading days in a year,
+// used to annualize daily returns.
+const tradingDays = 252
+
+// Compare compares scenarios whose results have been calculated.
+// The Sharpe ratio uses a risk free rate of 0.
+func Compare(scenarios ...*StockScenario) (*Comparison, error) {
+	return CompareRiskFree(0, scenarios...)
+}
+
+// CompareRiskFree compares scenarios whose results have been calculated,
+// with the Sharpe ratio using an annual risk free rate such as .02 for 2%.
+func CompareRiskFree(rate float64, scenarios ...*StockScenario) (*Comparison, error) {
+	if len(scenarios) == 0 {
+		return nil, errors.New("no scenarios to compare")
+	}
+
+	c := &Comparison{StartDate: 0, EndDate: MaxDate}
+	for i, sc := range scenarios {
+		if len(sc.Results) == 0 {
+			return nil, fmt.Errorf("scenario %d %s has no results", i, sc.label())
+		}
+		if first := sc.Results[0].Date; first > c.StartDate {
+			c.StartDate = first
+		}
+		if last := sc.Results[len(sc.Results)-1].Date; last < c.EndDate {
+			c.EndDate = last
+		}
+	}
+
+	if c.StartDate >= c.EndDate {
+		return nil, errors.New("scenarios have no dates in common")
+	}
+
+	c.mergeDates(scenarios)
+	for y := c.StartDate.Year(); y <= c.EndDate.Year(); y++ {
+		c.Years = append(c.Years, y)
+	}
+
+	for _, sc := range scenarios {
+		values, growth := c.series(sc)
+		c.Values = append(c.Values, values)
+		c.Growth = append(c.Growth, growth)
+		c.Summaries = append(c.Summaries, c.summary(sc, rate))
+		c.YearReturns = append(c.YearReturns, c.yearReturns(sc))
+	}
+
+	return c, nil
+}
+
+// summaryRows are the name and formatted value of
+// each row of the summary of a comparison.
+var summaryRows = []struct {
+	name  string
+	value func(s ComparisonSummary) string
+}{
+	{"Start amount", func(s ComparisonSummary) string { return s.StartAmt.String() }},
+	{"End amount", func(s ComparisonSummary) string { return s.EndAmt.String() }},
+	{"Total return", func(s ComparisonSummary) string { return formatPct(s.TotalReturn) }},
+	{"CAGR", func(s ComparisonSummary) string { return formatPct(s.CAGR) }},
+	{"Volatility", func(s ComparisonSummary) string { return formatPct(s.Volatility) }},
+	{"Max drawdown", func(s ComparisonSummary) string { return formatPct(s.MaxDrawdown) }},
+	{"Sharpe ratio", func(s ComparisonSummary) string { return fmt.Sprintf("%.2f", s.SharpeRatio) }},
+}
+
+// Write writes the comparison as a table with a column for each scenario.
+func (c *Comparison) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintf(tw, "%s to %s\t", c.StartDate, c.EndDate)
+	for _, s := range c.Summaries {
+		fmt.Fprintf(tw, "%s\t", s.Name)
+	}
+	fmt.Fprintln(tw)
+
+	for _, row := range summaryRows {
+		fmt.Fprintf(tw, "%s\t", row.name)
+		for _, s := range c.Summaries {
+			fmt.Fprintf(tw, "%s\t", row.value(s))
+		}
+		fmt.Fprintln(tw)
+	}
+
+	for y, year := range c.Years {
+		fmt.Fprintf(tw, "%d\t", year)
+		for s := range c.Summaries {
+			fmt.Fprintf(tw, "%s\t", formatPct(c.YearReturns[s][y]))
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// mergeDates sets Dates to all of the results dates
+// of the scenarios from StartDate to EndDate.
+func (c *Comparison) mergeDates(scenarios []*StockScenario) {
+	seen := make(map[Date]bool)
+	for _, sc := range scenarios {
+		for _, sr := range sc.Results {
+			if sr.Date >= c.StartDate && sr.Date <= c.EndDate && !seen[sr.Date] {
+				seen[sr.Date] = true
+				c.Dates = append(c.Dates, sr.Date)
+			}
+		}
+	}
+
+	sort.Slice(c.Dates, func(a, b int) bool {
+		return c.Dates[a] < c.Dates[b]
+	})
+}
+
+// series returns the value and growth of a scenario on each of the dates.
+func (c *Comparison) series(sc *StockScenario) ([]Money, []float64) {
+	values := make([]Money, len(c.Dates))
+	growth := make([]float64, len(c.Dates))
+	idx, g := 0, 1.0
+	for i, date := range c.Dates {
+		for idx+1 < len(sc.Results) && sc.Results[idx+1].Date <= date {
+			idx++
+			if sc.Results[idx].Date > c.StartDate {
+				g *= 1 + sc.Results[idx].PctChange
+			}
+		}
+		values[i] = sc.Results[idx].Value
+		growth[i] = g
+	}
+	return values, growth
+}
+
+// returns returns the results of a scenario, other than
+// the first, from after StartDate through EndDate.
+func (c *Comparison) returns(sc *StockScenario) []ScenarioResults {
+	var results []ScenarioResults
+	for i, sr := range sc.Results {
+		if i > 0 && sr.Date > c.StartDate && sr.Date <= c.EndDate {
+			results = append(results, sr)
+		}
+	}
+	return results
+}
+
+// summary returns the performance of a scenario.
+func (c *Comparison) summary(sc *StockScenario, rate float64) ComparisonSummary {
+	values := c.Values[len(c.Values)-1]
+	s := ComparisonSummary{Name: sc.label(), StartAmt: values[0], EndAmt: values[len(values)-1]}
+
+	growth, peak := 1.0, 1.0
+	s.DrawdownPeak, s.DrawdownLow = c.StartDate, c.StartDate
+	peakDate := c.StartDate
+
+	results := c.returns(sc)
+	mean := 0.0
+	for _, sr := range results {
+		growth *= 1 + sr.PctChange
+		mean += sr.PctChange
+
+		if growth > peak {
+			peak, peakDate = growth, sr.Date
+		}
+		if drawdown := growth/peak - 1; drawdown < s.MaxDrawdown {
+			s.MaxDrawdown = drawdown
+			s.DrawdownPeak, s.DrawdownLow = peakDate, sr.Date
+		}
+	}
+
+	years := float64(c.EndDate.Sub(c.StartDate)) / 365.25
+	s.TotalReturn = growth - 1
+	s.CAGR = math.Pow(growth, 1/years) - 1
+
+	if len(results) < 2 {
+		return s
+	}
+
+	mean = mean / float64(len(results))
+	s.Volatility = Volatility(pctChanges(results))
+	if s.Volatility > 0 {
+		s.SharpeRatio = (mean*tradingDays - rate) / s.Volatility
+	}
+
+	return s
+}
+
+// Volatility returns the annualized volatility of daily returns, such
+// as .15 for 15%: their sample standard deviation about their mean
+// times the square root of the trading days in a year.
+func Volatility(returns []float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean = mean / float64(len(returns))
+
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance = variance / float64(len(returns)-1)
+
+	return math.Sqrt(variance * tradingDays)
+}
+
+// Volatility returns the annualized volatility of the daily returns
+// of the scenario's results, as defined by the Volatility function.
+func (sc *StockScenario) Volatility() float64 {
+	if len(sc.Results) == 0 {
+		return 0
+	}
+	return Volatility(pctChanges(sc.Results[1:]))
+}
+
+// pctChanges returns the PctChange of each of the results.
+func pctChanges(results []ScenarioResults) []float64 {
+	pcts := make([]float64, len(results))
+	for i, sr := range results {
+		pcts[i] = sr.PctChange
+	}
+	return pcts
+}
+
+// yearReturns returns the return of a scenario in each of the Years.
+func (c *Comparison) yearReturns(sc *StockScenario) []float64 {
+	growth := make([]float64, len(c.Years))
+	for y := range growth {
+		growth[y] = 1
+	}
+
+	for _, sr := range c.returns(sc) {
+		y := sr.Date.Year() - c.Years[0]
+		growth[y] *= 1 + sr.PctChange
+	}
+
+	for y := range growth {
+		growth[y]--
+	}
+	return growth
+}
+
+// label returns the scenario Name, or its tickers and percents.
+func (sc *StockScenario) label() string {
+	if sc.Name != "" {
+		return sc.Name
+	}
+
+	var holdings []string
+	for i, stock := range sc.Stocks {
+		if sc.PctHolding[i] > 0 {
+			holdings = append(holdings, fmt.Sprintf("%s %g%%", stock.Ticker, sc.PctHolding[i]*100))
+		}
+	}
+	return strings.Join(holdings, ", ")
+}
+
+// formatPct formats a percent such as .1234 as "12.34%".
+func formatPct(pct float64) string {
+	return fmt.Sprintf("%.2f%%", pct*100)
+}
@@ -0,0 +1,104 @@
+package portfolio
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	if _, err := Compare(); err == nil {
+		t.Errorf("expected error comparing no scenarios")
+	}
+
+	sixtyForty := newTestScenario()
+	sixtyForty.Name = "60/40"
+	if err := sixtyForty.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := Compare(sixtyForty, NewStockScenario(0, MaxDate)); err == nil {
+		t.Errorf("expected error comparing scenario without results")
+	}
+
+	fxaix, _ := NewStock("FXAIX")
+	stocks := NewStockScenario(MustParseDate("2018-01-01"), MustParseDate("2021-12-31"))
+	stocks.AddStock(fxaix, 1)
+	if err := stocks.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c, err := Compare(sixtyForty, stocks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.StartDate != stocks.StartDate || c.EndDate != sixtyForty.EndDate {
+		t.Errorf("compared %s to %s, expected %s to %s",
+			c.StartDate, c.EndDate, stocks.StartDate, sixtyForty.EndDate)
+	}
+	if len(c.Years) != 3 || c.Years[0] != 2018 {
+		t.Errorf("years %v, expected 2018 through 2020", c.Years)
+	}
+	if c.Summaries[1].Name != "FXAIX 100%" {
+		t.Errorf("name %q, expected %q", c.Summaries[1].Name, "FXAIX 100%")
+	}
+
+	for s, values := range c.Values {
+		if len(values) != len(c.Dates) {
+			t.Fatalf("scenario %d has %d values for %d dates", s, len(values), len(c.Dates))
+		}
+
+		sum := c.Summaries[s]
+		if values[len(values)-1] != sum.EndAmt {
+			t.Errorf("scenario %d last value %s, expected %s", s, values[len(values)-1], sum.EndAmt)
+		}
+
+		if g := c.Growth[s][len(c.Growth[s])-1]; math.Abs(g-1-sum.TotalReturn) > 1e-9 {
+			t.Errorf("scenario %d growth %f, total return %f", s, g, sum.TotalReturn)
+		}
+
+		growth := 1.0
+		for _, r := range c.YearReturns[s] {
+			growth *= 1 + r
+		}
+		if math.Abs(growth-1-sum.TotalReturn) > 1e-9 {
+			t.Errorf("scenario %d years return %f, total %f", s, growth-1, sum.TotalReturn)
+		}
+
+		if sum.MaxDrawdown >= 0 || sum.DrawdownLow <= sum.DrawdownPeak {
+			t.Errorf("scenario %d drawdown %f from %s to %s", s, sum.MaxDrawdown, sum.DrawdownPeak, sum.DrawdownLow)
+		}
+		if sum.Volatility <= 0 || sum.SharpeRatio <= 0 {
+			t.Errorf("scenario %d volatility %f, Sharpe ratio %f", s, sum.Volatility, sum.SharpeRatio)
+		}
+	}
+
+	// the summaries, export and commands report the same volatility
+	alone, _ := Compare(sixtyForty)
+	if v := sixtyForty.Volatility(); math.Abs(v-alone.Summaries[0].Volatility) > 1e-9 || v != sixtyForty.Summary().Volatility {
+		t.Errorf("volatility %f, compared %f, summary %f", v, alone.Summaries[0].Volatility, sixtyForty.Summary().Volatility)
+	}
+	if v := Volatility([]float64{.01, -.01}); math.Abs(v-.02/math.Sqrt2*math.Sqrt(252)) > 1e-12 {
+		t.Errorf("volatility %f of +1%% and -1%%", v)
+	}
+
+	// stocks are more volatile and fell further in 2020
+	if c.Summaries[1].Volatility <= c.Summaries[0].Volatility {
+		t.Errorf("FXAIX volatility %f not more than 60/40 %f", c.Summaries[1].Volatility, c.Summaries[0].Volatility)
+	}
+	if c.Summaries[1].MaxDrawdown >= c.Summaries[0].MaxDrawdown {
+		t.Errorf("FXAIX drawdown %f not more than 60/40 %f", c.Summaries[1].MaxDrawdown, c.Summaries[0].MaxDrawdown)
+	}
+
+	var b bytes.Buffer
+	if err := c.Write(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []string{"60/40", "FXAIX 100%", "Max drawdown", "Sharpe ratio", "2019"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("comparison missing %q:\n%s", s, b.String())
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package portfolio
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Date is a calendar date with no time of day or time zone,
+// stored as the number of days since 1970-01-01.
+// Dates can be compared with the usual operators.
+type Date int32
+
+// MaxDate is later than any date in stock history.
+const MaxDate Date = 1<<31 - 1
+
+const dateFormat = "2006-01-02"
+
+// dateLayouts are the date formats accepted by ParseDate.
+// Dates with slashes or dashes and the month first are
+// in the US month/day/year order.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"20060102",
+	"1/2/2006",
+	"1-2-2006",
+	"1/2/06",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2-Jan-2006",
+	"2-Jan-06",
+	"2 Jan 2006",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+// NewDate returns the Date for a year, month and day.
+// Values outside their usual ranges are normalized,
+// for example October 32 becomes November 1.
+func NewDate(year int, month time.Month, day int) Date {
+	return DateOf(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+// DateOf returns the Date of a time in the time's location.
+func DateOf(t time.Time) Date {
+	year, month, day := t.Date()
+	u := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return Date(u.Unix() / (24 * 60 * 60))
+}
+
+// ParseDate parses a date in "yyyy-mm-dd" format or one of the
+// other common formats used by data vendors and brokerages, such as
+// "mm/dd/yyyy", "yyyymmdd", "Jan 2, 2006" and "02-Jan-2006".
+func ParseDate(s string) (Date, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return DateOf(t), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid date '%s'", s)
+}
+
+// MustParseDate is like ParseDate but panics if the date is invalid.
+// It is intended for dates which are known to be valid, such as in tests.
+func MustParseDate(s string) Date {
+	d, err := ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Time returns midnight UTC on the date.
+func (d Date) Time() time.Time {
+	return time.Unix(int64(d)*24*60*60, 0).UTC()
+}
+
+// String returns the date in "yyyy-mm-dd" format.
+func (d Date) String() string {
+	return d.Time().Format(dateFormat)
+}
+
+// Year returns the year of the date.
+func (d Date) Year() int {
+	return d.Time().Year()
+}
+
+// Month returns the month of the date.
+func (d Date) Month() time.Month {
+	return d.Time().Month()
+}
+
+// Day returns the day of the month of the date.
+func (d Date) Day() int {
+	return d.Time().Day()
+}
+
+// Weekday returns the day of the week of the date.
+func (d Date) Weekday() time.Weekday {
+	return d.Time().Weekday()
+}
+
+// AddDays returns the date a number of days after d.
+func (d Date) AddDays(days int) Date {
+	return d + Date(days)
+}
+
+// AddDate returns the date a number of years, months and days after d,
+// normalized in the same way as time.Time.AddDate.
+func (d Date) AddDate(years, months, days int) Date {
+	return DateOf(d.Time().AddDate(years, months, days))
+}
+
+// AddMonths returns the date a number of months after d. Unlike
+// AddDate, a day past the end of the month is the last day of the month,
+// so January 31 plus one month is the last day of February.
+func (d Date) AddMonths(months int) Date {
+	t := d.Time()
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return DateOf(first.AddDate(0, 0, day-1))
+}
+
+// Sub returns the number of days from u to d.
+func (d Date) Sub(u Date) int {
+	return int(d - u)
+}
+
+// SameMonth returns true if d and u are in the same month of the same year.
+func (d Date) SameMonth(u Date) bool {
+	return d.Year() == u.Year() && d.Month() == u.Month()
+}
+
+// MarshalText returns the date in "yyyy-mm-dd" format.
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText parses a date in any of the formats accepted by ParseDate.
+func (d *Date) UnmarshalText(text []byte) error {
+	date, err := ParseDate(string(text))
+	if err != nil {
+		return err
+	}
+	*d = date
+	return nil
+}
@@ -0,0 +1,94 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	want := NewDate(2020, time.March, 9)
+
+	for _, s := range []string{
+		"2020-03-09",
+		"2020/03/09",
+		"20200309",
+		"03/09/2020",
+		"3/9/2020",
+		"03-09-2020",
+		"3/9/20",
+		"Mar 9, 2020",
+		"March 9, 2020",
+		"09-Mar-2020",
+		"9-Mar-20",
+		"9 Mar 2020",
+		"2020-03-09T16:00:00-04:00",
+		"2020-03-09 16:00:00",
+		" 2020-03-09 ",
+	} {
+		d, err := ParseDate(s)
+		if err != nil {
+			t.Errorf("unexpected error parsing '%s': %v", s, err)
+		} else if d != want {
+			t.Errorf("'%s' parsed as %s", s, d)
+		}
+	}
+
+	for _, s := range []string{"202x-01-01", "3000x-12-31", "2020-02-30", ""} {
+		if _, err := ParseDate(s); err == nil {
+			t.Errorf("didn't catch invalid date '%s'", s)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	d := MustParseDate("2020-02-28")
+
+	if d.String() != "2020-02-28" || d.Year() != 2020 || d.Month() != time.February || d.Day() != 28 {
+		t.Errorf("invalid date parts for %s", d)
+	}
+
+	if d.Weekday() != time.Friday {
+		t.Errorf("%s weekday %s", d, d.Weekday())
+	}
+
+	if d.AddDays(1).String() != "2020-02-29" || d.AddDays(2).String() != "2020-03-01" {
+		t.Errorf("invalid AddDays %s %s", d.AddDays(1), d.AddDays(2))
+	}
+
+	if d.AddDate(0, -1, 0).String() != "2020-01-28" {
+		t.Errorf("invalid AddDate %s", d.AddDate(0, -1, 0))
+	}
+
+	jan31 := MustParseDate("2020-01-31")
+	for months, want := range []string{"2020-01-31", "2020-02-29", "2020-03-31", "2020-04-30"} {
+		if got := jan31.AddMonths(months).String(); got != want {
+			t.Errorf("AddMonths(%d) %s, expected %s", months, got, want)
+		}
+	}
+	if got := jan31.AddMonths(-2).String(); got != "2019-11-30" {
+		t.Errorf("AddMonths(-2) %s, expected 2019-11-30", got)
+	}
+
+	if MustParseDate("2021-01-01").Sub(d) != 308 {
+		t.Errorf("invalid Sub %d", MustParseDate("2021-01-01").Sub(d))
+	}
+
+	if !d.SameMonth(MustParseDate("2020-02-01")) || d.SameMonth(MustParseDate("2021-02-28")) {
+		t.Error("invalid SameMonth")
+	}
+
+	if DateOf(time.Date(2020, 2, 28, 23, 0, 0, 0, time.FixedZone("PST", -8*60*60))) != d {
+		t.Error("DateOf not using time's location")
+	}
+
+	b, err := json.Marshal(struct{ D Date }{d})
+	if err != nil || string(b) != `{"D":"2020-02-28"}` {
+		t.Errorf("invalid json %s %v", b, err)
+	}
+
+	var v struct{ D Date }
+	if err = json.Unmarshal([]byte(`{"D":"02/28/2020"}`), &v); err != nil || v.D != d {
+		t.Errorf("invalid json unmarshal %s %v", v.D, err)
+	}
+}
@@ -0,0 +1,173 @@
+package portfolio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Summary returns the summary of the scenario's results.
+func (sc *StockScenario) Summary() ScenarioSummary {
+	s := ScenarioSummary{
+		Name:           sc.Name,
+		StartDate:      sc.StartDate,
+		EndDate:        sc.EndDate,
+		StartAmt:       sc.StartAmt,
+		EndAmt:         sc.EndAmt,
+		TotalReturn:    sc.PctChange,
+		CAGR:           sc.CAGR,
+		Volatility:     sc.Volatility(),
+		Income:         sc.Income,
+		NetCashFlow:    sc.NetCashFlow,
+		TradingCosts:   sc.TradingCosts,
+		AfterTaxEndAmt: sc.AfterTaxEndAmt,
+	}
+
+	for i, stock := range sc.Stocks {
+		s.Holdings = append(s.Holdings, HoldingSummary{Ticker: stock.Ticker, Pct: sc.PctHolding[i]})
+	}
+	return s
+}
+
+// Rows returns a row for each of the scenario's results.
+func (sc *StockScenario) Rows() []ResultRow {
+	rows := make([]ResultRow, len(sc.Results))
+	for r, sr := range sc.Results {
+		rows[r] = ResultRow{
+			Date:       sr.Date,
+			Holdings:   make([]ResultHolding, len(sc.Stocks)),
+			Cash:       sr.Cash,
+			Loan:       sr.Loan,
+			CashFlow:   sr.CashFlow,
+			Dividends:  sr.Dividends,
+			Income:     sr.Income,
+			Costs:      sr.Costs,
+			Value:      sr.Value,
+			PctChange:  sr.PctChange,
+			Rebalanced: sr.Rebalanced,
+		}
+
+		for i, stock := range sc.Stocks {
+			close := stock.History[sr.StockHistIdx[i]].Close
+			rows[r].Holdings[i] = ResultHolding{
+				Ticker: stock.Ticker,
+				Shares: sr.Shares[i],
+				Price:  close,
+				Value:  sr.Shares[i].Value(close),
+			}
+		}
+	}
+	return rows
+}
+
+// MarshalJSON returns the summary as JSON, with the floats which are
+// not finite, such as the CAGR of a scenario ending with a negative
+// value, as null.
+func (s ScenarioSummary) MarshalJSON() ([]byte, error) {
+	type summary ScenarioSummary
+	return json.Marshal(struct {
+		summary
+		TotalReturn *float64 `json:"total_return"`
+		CAGR        *float64 `json:"cagr"`
+		Volatility  *float64 `json:"volatility"`
+	}{summary(s), finite(s.TotalReturn), finite(s.CAGR), finite(s.Volatility)})
+}
+
+// MarshalJSON returns the row as JSON, with pct_change null if it
+// is not finite.
+func (r ResultRow) MarshalJSON() ([]byte, error) {
+	type row ResultRow
+	return json.Marshal(struct {
+		row
+		PctChange *float64 `json:"pct_change"`
+	}{row(r), finite(r.PctChange)})
+}
+
+// finite returns a pointer to f, or nil if f is infinite or NaN.
+func finite(f float64) *float64 {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil
+	}
+	return &f
+}
+
+// WriteJSON writes the scenario's summary and results as JSON.
+func (sc *StockScenario) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Summary ScenarioSummary `json:"summary"`
+		Results []ResultRow     `json:"results"`
+	}{sc.Summary(), sc.Rows()})
+}
+
+// WriteCSV writes the scenario's results as CSV with a header row. The
+// columns are the date, the shares, price and value of each stock in
+// the order added, then cash, loan, cash_flow, dividends, income,
+// costs, value, pct_change and rebalanced.
+func (sc *StockScenario) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"date"}
+	for _, stock := range sc.Stocks {
+		for _, col := range []string{"shares", "price", "value"} {
+			header = append(header, stock.Ticker+"_"+col)
+		}
+	}
+	header = append(header, "cash", "loan", "cash_flow", "dividends",
+		"income", "costs", "value", "pct_change", "rebalanced")
+	cw.Write(header)
+
+	for _, row := range sc.Rows() {
+		record := []string{row.Date.String()}
+		for _, h := range row.Holdings {
+			record = append(record, h.Shares.String(), h.Price.String(), h.Value.String())
+		}
+		record = append(record, row.Cash.String(), row.Loan.String(),
+			row.CashFlow.String(), row.Dividends.String(), row.Income.String(),
+			row.Costs.String(), row.Value.String(), formatFloat(row.PctChange),
+			strconv.FormatBool(row.Rebalanced))
+		cw.Write(record)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteSummaryCSV writes the summary of each scenario as a row of CSV
+// with a header row. Holdings are written as "TICKER=pct" separated by
+// spaces.
+func WriteSummaryCSV(w io.Writer, scenarios ...*StockScenario) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "start_date", "end_date", "holdings",
+		"start_amt", "end_amt", "total_return", "cagr", "volatility",
+		"income", "net_cash_flow", "trading_costs", "after_tax_end_amt"})
+
+	for _, sc := range scenarios {
+		s := sc.Summary()
+
+		var holdings []string
+		for _, h := range s.Holdings {
+			holdings = append(holdings, fmt.Sprintf("%s=%s", h.Ticker, formatFloat(h.Pct)))
+		}
+
+		cw.Write([]string{s.Name, s.StartDate.String(), s.EndDate.String(),
+			strings.Join(holdings, " "), s.StartAmt.String(), s.EndAmt.String(),
+			formatFloat(s.TotalReturn), formatFloat(s.CAGR), formatFloat(s.Volatility),
+			s.Income.String(), s.NetCashFlow.String(), s.TradingCosts.String(),
+			s.AfterTaxEndAmt.String()})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatFloat formats a float with the fewest digits
+// needed to represent it exactly.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
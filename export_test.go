@@ -0,0 +1,126 @@
+package portfolio
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	sc := newTestScenario()
+	sc.Name = "60/40"
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := sc.WriteJSON(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got struct {
+		Summary ScenarioSummary `json:"summary"`
+		Results []ResultRow     `json:"results"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Summary.Name != "60/40" || got.Summary.EndAmt != sc.EndAmt || got.Summary.StartDate != sc.StartDate {
+		t.Errorf("summary %+v does not match scenario", got.Summary)
+	}
+	if len(got.Summary.Holdings) != 2 || got.Summary.Holdings[1] != (HoldingSummary{"FXNAX", .4}) {
+		t.Errorf("holdings %+v, expected FXAIX .6 and FXNAX .4", got.Summary.Holdings)
+	}
+
+	if len(got.Results) != len(sc.Results) {
+		t.Fatalf("%d results, expected %d", len(got.Results), len(sc.Results))
+	}
+
+	rebalances := 0
+	for r, row := range got.Results {
+		sr := sc.Results[r]
+		if row.Date != sr.Date || row.Value != sr.Value || row.Holdings[0].Shares != sr.Shares[0] {
+			t.Fatalf("row %d %+v does not match results %+v", r, row, sr)
+		}
+		if row.Rebalanced {
+			rebalances++
+		}
+	}
+
+	// the initial purchase and 60 monthly rebalances
+	if rebalances != 61 {
+		t.Errorf("%d rebalances, expected 61", rebalances)
+	}
+}
+
+func TestMarshalNotFinite(t *testing.T) {
+	b, err := json.Marshal(ScenarioSummary{Name: "margin", CAGR: math.NaN(), TotalReturn: -1.5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := string(b); !strings.Contains(s, `"cagr":null`) || !strings.Contains(s, `"total_return":-1.5`) {
+		t.Errorf("summary %s, expected cagr null", s)
+	}
+
+	b, err = json.Marshal(ResultRow{PctChange: math.Inf(1)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(b), `"pct_change":null`) {
+		t.Errorf("row %s, expected pct_change null", b)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	sc := newTestScenario()
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := sc.WriteCSV(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header := "date,FXAIX_shares,FXAIX_price,FXAIX_value,FXNAX_shares,FXNAX_price,FXNAX_value," +
+		"cash,loan,cash_flow,dividends,income,costs,value,pct_change,rebalanced"
+	if strings.Join(records[0], ",") != header {
+		t.Errorf("header %v, expected %s", records[0], header)
+	}
+	if len(records) != len(sc.Results)+1 {
+		t.Fatalf("%d records, expected %d", len(records), len(sc.Results)+1)
+	}
+
+	last := records[len(records)-1]
+	if last[0] != sc.EndDate.String() || last[13] != sc.EndAmt.String() {
+		t.Errorf("last record %v, expected %s and %s", last, sc.EndDate, sc.EndAmt)
+	}
+
+	dividends := false
+	for _, record := range records[1:] {
+		if record[10] != "0.00" {
+			dividends = true
+		}
+	}
+	if !dividends {
+		t.Errorf("no dividends in results")
+	}
+
+	b.Reset()
+	if err := WriteSummaryCSV(&b, sc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 2 ||
+		!strings.Contains(lines[1], "FXAIX=0.6 FXNAX=0.4") {
+		t.Errorf("unexpected summary:\n%s", b.String())
+	}
+}
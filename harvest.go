@@ -0,0 +1,235 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// washSaleDays is the number of days after selling a stock at a loss
+// during which buying it back makes the sale a wash sale.
+const washSaleDays = 30
+
+// AddSubstitute adds a substitute for a stock already in the scenario.
+// The substitute has a percent of 0 and is only held after harvesting
+// sells the stock, when it takes over the stock's percent.
+// Harvesting may later swap back from the substitute to the stock.
+func (sc *StockScenario) AddSubstitute(ticker string, substitute *Stock) error {
+	idx, err := findTicker(sc.Stocks, ticker)
+	if err != nil {
+		return err
+	}
+
+	for primary, sub := range sc.substitutes {
+		if primary == idx || sub == idx {
+			return fmt.Errorf("stock %s already has a substitute", ticker)
+		}
+	}
+
+	if sc.substitutes == nil {
+		sc.substitutes = make(map[int]int)
+	}
+
+	sc.Stocks = append(sc.Stocks, substitute)
+	sc.PctHolding = append(sc.PctHolding, 0)
+	sc.Options = append(sc.Options, sc.Options[idx])
+	sc.substitutes[idx] = len(sc.Stocks) - 1
+
+	return nil
+}
+
+// initHarvest verifies the harvest rule and initializes
+// the harvesting state so each stock, not its substitute, is held.
+func (sc *StockScenario) initHarvest() error {
+	if sc.Harvest == nil {
+		return nil
+	}
+
+	if sc.Tax == nil {
+		return errors.New("Harvest requires a Tax model")
+	}
+
+	if sc.Harvest.Threshold <= 0 {
+		return errors.New("harvest Threshold not greater than 0")
+	}
+
+	if len(sc.substitutes) == 0 {
+		return errors.New("Harvest requires a substitute stock")
+	}
+
+	sc.pairOf = make([]int, len(sc.Stocks))
+	sc.held = make([]bool, len(sc.Stocks))
+	for i := range sc.Stocks {
+		sc.pairOf[i] = -1
+		sc.held[i] = true
+	}
+
+	for primary, sub := range sc.substitutes {
+		sc.pairOf[primary] = sub
+		sc.pairOf[sub] = primary
+		sc.held[sub] = false
+	}
+
+	sc.lossSales = make(map[int]Date)
+
+	return nil
+}
+
+// harvestPcts returns the target percents with the percent for each
+// stock and its substitute moved to whichever of the two is held. Shares
+// of the one not held are kept, up to the pair's percent of investable,
+// so its lots with gains are not sold after its losses are harvested.
+func (sc *StockScenario) harvestPcts(sr *ScenarioResults, pcts []float64, investable Money) []float64 {
+	if sc.Harvest == nil {
+		return pcts
+	}
+
+	result := make([]float64, len(pcts))
+	for i, pct := range pcts {
+		if sc.held[i] {
+			result[i] += pct
+			continue
+		}
+
+		pair := sc.pairOf[i]
+		total := pct + pcts[pair]
+		kept := 0.0
+		if investable > 0 {
+			close := sc.Stocks[i].History[sr.StockHistIdx[i]].Close
+			kept = math.Min(sr.Shares[i].Value(close).Float()/investable.Float(), total)
+		}
+		result[i] += kept
+		result[pair] += total - kept
+	}
+
+	return result
+}
+
+// harvestLosses sells the lots of any stock with a substitute whose loss
+// is at least the harvest threshold, and buys the other stock of the pair,
+// which is then held. A stock is not bought within 30 days after it was
+// sold at a loss.
+func (sr *ScenarioResults) harvestLosses(sc *StockScenario) {
+	for a, stock := range sc.Stocks {
+		b := sc.pairOf[a]
+		if b < 0 || sr.Shares[a] == 0 {
+			continue
+		}
+
+		if sold, ok := sc.lossSales[b]; ok && sr.Date.Sub(sold) <= washSaleDays {
+			continue
+		}
+
+		close := stock.History[sr.StockHistIdx[a]].Close
+		shares, loss := sc.harvestLots(a, sr.Date, close)
+		if shares == 0 {
+			continue
+		}
+		sr.Shares[a] -= shares
+
+		sc.held[a] = false
+		sc.held[b] = true
+		sr.buyShares(sc, b, shares.Value(close), sc.Stocks[b].History[sr.StockHistIdx[b]].Close)
+
+		sc.lossSales[a] = sr.Date
+		sc.HarvestedLosses += loss
+		sc.Harvests++
+	}
+}
+
+// harvestLots sells the lots of stock i whose loss is at least the harvest
+// threshold of their cost, and returns the shares sold and the loss realized.
+// Lots bought within 30 days before the sale, including from reinvested
+// dividends, are not sold. They replace as many of the shares sold, so the
+// loss on those shares is a wash sale: it is not realized and is added to
+// the cost of the replacement lots instead. No lots are sold if none of
+// the loss would be realized.
+func (sc *StockScenario) harvestLots(i int, date Date, close Price) (Quantity, Money) {
+	recent := func(lot Lot) bool {
+		return date.Sub(lot.Date) <= washSaleDays
+	}
+
+	replacements := Quantity(0)
+	for _, lot := range sc.Lots[i] {
+		if recent(lot) {
+			replacements += lot.Shares
+		}
+	}
+
+	type sale struct {
+		bought Date
+		gain   Money
+	}
+	var sales []sale
+	var kept []Lot
+	var sold Quantity
+	var realized, washed Money
+	replaced := replacements
+	for _, lot := range sc.Lots[i] {
+		loss := lot.Cost - lot.Shares.Value(close)
+		if recent(lot) || loss <= 0 || loss < lot.Cost.Mul(sc.Harvest.Threshold) {
+			kept = append(kept, lot)
+			continue
+		}
+
+		wash := Money(0)
+		if replaced > 0 {
+			n := lot.Shares
+			if n > replaced {
+				n = replaced
+			}
+			wash = Money(mulDivRound(int64(loss), int64(n), int64(lot.Shares)))
+			replaced -= n
+		}
+
+		sales = append(sales, sale{lot.Date, wash - loss})
+		sold += lot.Shares
+		realized += loss - wash
+		washed += wash
+	}
+
+	if realized <= 0 {
+		return 0, 0
+	}
+
+	for _, s := range sales {
+		sc.addGain(date, s.bought, s.gain)
+	}
+
+	// the replacement lots share the disallowed loss by their shares
+	for k := range kept {
+		if washed == 0 {
+			break
+		}
+		if !recent(kept[k]) {
+			continue
+		}
+		add := washed
+		if kept[k].Shares < replacements {
+			add = Money(mulDivRound(int64(washed), int64(kept[k].Shares), int64(replacements)))
+		}
+		kept[k].Cost += add
+		washed -= add
+		replacements -= kept[k].Shares
+	}
+
+	sc.Lots[i] = kept
+	return sold, realized
+}
+
+// calcHarvestBenefit runs the same scenario without harvesting
+// and sets HarvestBenefit to the difference in AfterTaxEndAmt.
+func (sc *StockScenario) calcHarvestBenefit(ctx context.Context, initialAmount float64) error {
+	without := *sc
+	without.Harvest = nil
+	without.Results = nil
+	without.Progress = nil
+
+	if err := without.CalcResultsContext(ctx, initialAmount); err != nil {
+		return err
+	}
+
+	sc.HarvestBenefit = sc.AfterTaxEndAmt - without.AfterTaxEndAmt
+	return nil
+}
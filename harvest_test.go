@@ -0,0 +1,102 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+func TestHarvest(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	vig, _ := NewStock("VIG")
+	fxnax, _ := NewStock("FXNAX")
+
+	sc := NewStockScenario(MustParseDate("2020-01-01"), MustParseDate("2020-12-31"))
+	sc.AddStock(fxaix, .6)
+	sc.AddStock(fxnax, .4)
+	if err := sc.AddSubstitute("FXAIX", vig); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sc.Tax = &TaxModel{QualifiedRate: .15, OrdinaryRate: .3, ShortTermRate: .3, LongTermRate: .15, Liquidate: true}
+	sc.Harvest = &HarvestRule{Threshold: .05}
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sc.Harvests == 0 || sc.HarvestedLosses <= 0 {
+		t.Fatalf("no losses harvested in 2020: %d %s", sc.Harvests, sc.HarvestedLosses)
+	}
+
+	if sc.Gains[0].ShortTerm >= 0 {
+		t.Errorf("harvested losses not realized: %+v", sc.Gains)
+	}
+
+	if sc.HarvestBenefit == 0 {
+		t.Error("harvest benefit not calculated")
+	}
+
+	// a stock is not bought within 30 days after it was sold for the other
+	// stock of the pair
+	sold := map[int]Date{}
+	swaps := 0
+	for i := 1; i < len(sc.Results); i++ {
+		sr, prev := sc.Results[i], sc.Results[i-1]
+		for _, pair := range [][2]int{{0, 2}, {2, 0}} {
+			a, b := pair[0], pair[1]
+			if date, ok := sold[a]; ok && sr.Shares[a] > prev.Shares[a] && sr.Date.Sub(date) <= washSaleDays {
+				t.Errorf("%s bought on %s, within 30 days of selling on %s", sc.Stocks[a].Ticker, sr.Date, date)
+			}
+			if sr.Shares[a] < prev.Shares[a] && sr.Shares[b] > prev.Shares[b] {
+				sold[a] = sr.Date
+				swaps++
+			}
+		}
+	}
+	if swaps < sc.Harvests {
+		t.Errorf("%d swaps for %d harvests", swaps, sc.Harvests)
+	}
+
+	if err := sc.AddSubstitute("FXAIX", vig); err == nil {
+		t.Error("missed error second substitute")
+	}
+
+	sc.Tax = nil
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error harvest without tax")
+	}
+}
+
+func TestHarvestLots(t *testing.T) {
+	date := MustParseDate("2020-03-16")
+	sc := &StockScenario{Stocks: []*Stock{{Ticker: "XXX"}}, Lots: make([][]Lot, 1),
+		Harvest: &HarvestRule{Threshold: .05}}
+
+	// at 10 a share: a lot with a loss, a lot with a gain
+	// and a lot with a loss bought within 30 days
+	sc.addLot(0, Lot{Date: MustParseDate("2019-01-02"), Shares: NewQuantity(10), Cost: NewMoney(200)})
+	sc.addLot(0, Lot{Date: MustParseDate("2019-06-03"), Shares: NewQuantity(10), Cost: NewMoney(50)})
+	sc.addLot(0, Lot{Date: MustParseDate("2020-03-02"), Shares: NewQuantity(2), Cost: NewMoney(30)})
+
+	shares, loss := sc.harvestLots(0, date, NewPrice(10))
+	if shares != NewQuantity(10) {
+		t.Errorf("sold %s shares, expected 10", shares)
+	}
+
+	// the loss on the 2 shares replaced is a wash sale
+	if loss != NewMoney(80) || len(sc.Gains) != 1 || sc.Gains[0].LongTerm != NewMoney(-80) {
+		t.Errorf("loss %s, gains %+v, expected 80.00", loss, sc.Gains)
+	}
+
+	lots := sc.Lots[0]
+	if len(lots) != 2 || lots[0].Cost != NewMoney(50) || lots[1].Cost != NewMoney(50) {
+		t.Errorf("lots %+v, expected the gain lot and the replacement lot costing 50.00", lots)
+	}
+
+	// the remaining loss is all a wash sale
+	sc.Lots[0] = []Lot{
+		{Date: MustParseDate("2019-01-02"), Shares: NewQuantity(2), Cost: NewMoney(40)},
+		{Date: MustParseDate("2020-03-02"), Shares: NewQuantity(2), Cost: NewMoney(30)},
+	}
+	if shares, _ := sc.harvestLots(0, date, NewPrice(10)); shares != 0 || len(sc.Lots[0]) != 2 {
+		t.Errorf("sold %s shares of lots %+v with the loss disallowed", shares, sc.Lots[0])
+	}
+}
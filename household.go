@@ -0,0 +1,396 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// NewPortfolio creates a new household portfolio
+// without any accounts or stock allocations.
+func NewPortfolio(name string) *Portfolio {
+	return &Portfolio{Name: name}
+}
+
+// AddAccount adds an empty account to the portfolio.
+func (p *Portfolio) AddAccount(name string, accountType AccountType) (*Account, error) {
+
+	if accountType < Taxable || accountType > Roth {
+		return nil, fmt.Errorf("invalid account type %d", accountType)
+	}
+
+	if p.Account(name) != nil {
+		return nil, fmt.Errorf("account %s already in portfolio", name)
+	}
+
+	a := &Account{Name: name, Type: accountType}
+	p.Accounts = append(p.Accounts, a)
+	return a, nil
+}
+
+// Account returns the account with a name, or nil if there is none.
+func (p *Portfolio) Account(name string) *Account {
+	for _, a := range p.Accounts {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// AddStock adds a stock to the household target allocation.
+func (p *Portfolio) AddStock(stock *Stock, pct float64) error {
+
+	if pct > 1 {
+		return errors.New("pct greater than 1")
+	}
+
+	if pct <= 0 {
+		return errors.New("pct less than 0")
+	}
+
+	if _, err := findTicker(p.Stocks, stock.Ticker); err == nil {
+		return fmt.Errorf("stock %s already in portfolio", stock.Ticker)
+	}
+
+	p.Stocks = append(p.Stocks, stock)
+	p.PctHolding = append(p.PctHolding, pct)
+	p.Options = append(p.Options, StockOptions{})
+
+	return nil
+}
+
+// SetStockOptions sets the options for a stock which has already been
+// added to the portfolio. Only QualifiedPct and Rounding are used.
+func (p *Portfolio) SetStockOptions(ticker string, opts StockOptions) error {
+
+	if !opts.Rounding.valid() {
+		return errors.New("invalid share rounding")
+	}
+
+	if opts.QualifiedPct < 0 || opts.QualifiedPct > 1 {
+		return errors.New("qualified pct not between 0 and 1")
+	}
+
+	i, err := findTicker(p.Stocks, ticker)
+	if err != nil {
+		return err
+	}
+
+	p.Options[i] = opts
+	return nil
+}
+
+// AddHolding adds shares of a stock to an account. Lots are added to the
+// lots of any shares of the stock already held.
+func (a *Account) AddHolding(stock *Stock, shares Quantity, lots []Lot) {
+	for i := range a.Holdings {
+		if a.Holdings[i].Stock.Ticker == stock.Ticker {
+			a.Holdings[i].Shares += shares
+			a.Holdings[i].Lots = append(a.Holdings[i].Lots, lots...)
+			return
+		}
+	}
+
+	a.Holdings = append(a.Holdings, Holding{Stock: stock, Shares: shares, Lots: lots})
+}
+
+// Value returns the value of the account's holdings at the
+// close on a date plus its cash.
+func (a *Account) Value(date Date) (Money, error) {
+	value := a.Cash
+	for _, h := range a.Holdings {
+		close, err := h.Stock.closeOn(date)
+		if err != nil {
+			return 0, err
+		}
+		value += h.Shares.Value(close)
+	}
+	return value, nil
+}
+
+// Value returns the total value of all of the accounts on a date.
+func (p *Portfolio) Value(date Date) (Money, error) {
+	total := Money(0)
+	for _, a := range p.Accounts {
+		value, err := a.Value(date)
+		if err != nil {
+			return 0, fmt.Errorf("account %s: %v", a.Name, err)
+		}
+		total += value
+	}
+	return total, nil
+}
+
+// TaxDrag returns the estimated tax for a year on the dividends and
+// distributions of the stocks held in Taxable accounts, based on their
+// dividends and distributions over the year before a date.
+func (p *Portfolio) TaxDrag(date Date) (Money, error) {
+	if p.Tax == nil {
+		return 0, errors.New("Tax not set")
+	}
+
+	drag := Money(0)
+	for _, a := range p.Accounts {
+		if a.Type != Taxable {
+			continue
+		}
+
+		for _, h := range a.Holdings {
+			close, err := h.Stock.closeOn(date)
+			if err != nil {
+				return 0, err
+			}
+
+			qualifiedPct := 0.0
+			if i, err := findTicker(p.Stocks, h.Stock.Ticker); err == nil {
+				qualifiedPct = p.Options[i].QualifiedPct
+			}
+
+			drag += h.Shares.Value(close).Mul(p.Tax.dragRate(h.Stock, date, qualifiedPct))
+		}
+	}
+
+	return drag, nil
+}
+
+// Locate places the household target value of each stock in the accounts
+// so as to minimize tax drag, without changing the value of any account.
+//
+// The stocks with the highest tax drag are placed in the tax advantaged
+// accounts until they are full. Of those, the stocks with the highest
+// trailing five year return are placed in Roth accounts, since their growth
+// is never taxed, and the rest in TraditionalIRA accounts. The remaining
+// stocks are placed in Taxable accounts. Any value not allocated to a
+// stock is left in an account as cash.
+func (p *Portfolio) Locate(date Date) ([]Location, error) {
+	if p.Tax == nil {
+		return nil, errors.New("Tax not set")
+	}
+
+	if len(p.Stocks) == 0 {
+		return nil, errors.New("no stocks in portfolio")
+	}
+
+	if total := sum(p.PctHolding); total > 1+pctTolerance {
+		return nil, fmt.Errorf("stock percents total %g, more than 1", total)
+	}
+
+	capacity := make([]Money, len(p.Accounts))
+	total := Money(0)
+	for k, a := range p.Accounts {
+		value, err := a.Value(date)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", a.Name, err)
+		}
+		capacity[k] = value
+		total += value
+	}
+
+	drag := make([]float64, len(p.Stocks))
+	growth := make([]float64, len(p.Stocks))
+	target := make([]Money, len(p.Stocks))
+	for i, stock := range p.Stocks {
+		if _, err := stock.closeOn(date); err != nil {
+			return nil, err
+		}
+		drag[i] = p.Tax.dragRate(stock, date, p.Options[i].QualifiedPct)
+		growth[i] = expectedGrowth(stock, date)
+		target[i] = total.Mul(p.PctHolding[i])
+	}
+
+	byDrag := make([]int, len(p.Stocks))
+	for i := range byDrag {
+		byDrag[i] = i
+	}
+	byGrowth := make([]int, len(p.Stocks))
+	copy(byGrowth, byDrag)
+
+	sort.SliceStable(byDrag, func(a, b int) bool {
+		return drag[byDrag[a]] > drag[byDrag[b]]
+	})
+	sort.SliceStable(byGrowth, func(a, b int) bool {
+		return growth[byGrowth[a]] > growth[byGrowth[b]]
+	})
+
+	var taxable, deferred, roth []int
+	sheltered := Money(0)
+	for k, a := range p.Accounts {
+		switch a.Type {
+		case Taxable:
+			taxable = append(taxable, k)
+		case TraditionalIRA:
+			deferred = append(deferred, k)
+			sheltered += capacity[k]
+		case Roth:
+			roth = append(roth, k)
+			sheltered += capacity[k]
+		}
+	}
+
+	// the highest drag stocks go in the tax advantaged accounts
+	shelter := make([]Money, len(p.Stocks))
+	for _, i := range byDrag {
+		amt := minMoney(target[i], sheltered)
+		shelter[i] = amt
+		target[i] -= amt
+		sheltered -= amt
+	}
+
+	locations := make([]Location, len(p.Accounts))
+	for k, a := range p.Accounts {
+		locations[k] = Location{Account: a, Values: make([]Money, len(p.Stocks))}
+	}
+
+	fillAccounts(locations, roth, byGrowth, shelter, capacity)
+	fillAccounts(locations, deferred, byGrowth, shelter, capacity)
+	fillAccounts(locations, taxable, byDrag, target, capacity)
+
+	return locations, nil
+}
+
+// Rebalance buys and sells the stocks in each account to hold the value
+// of each stock placed in the account by Locate, in the stock's
+// ShareRounding. Holdings of stocks not in the portfolio are sold.
+// Shares sold from Taxable accounts are removed from the lots selected by
+// the portfolio's LotMethod and the realized gains are returned.
+func (p *Portfolio) Rebalance(date Date) ([]RealizedGains, error) {
+	locations, err := p.Locate(date)
+	if err != nil {
+		return nil, err
+	}
+
+	var gains []RealizedGains
+	for _, loc := range locations {
+		a := loc.Account
+		cash, err := a.Value(date)
+		if err != nil {
+			return nil, err
+		}
+
+		var holdings []Holding
+		for i, stock := range p.Stocks {
+			close, err := stock.closeOn(date)
+			if err != nil {
+				return nil, err
+			}
+			shares := close.Shares(loc.Values[i], p.Options[i].Rounding.decimals())
+			cash -= shares.Value(close)
+
+			h := Holding{Stock: stock}
+			if held := a.findHolding(stock.Ticker); held != nil {
+				h = *held
+			}
+
+			if a.Type == Taxable {
+				if shares > h.Shares {
+					bought := shares - h.Shares
+					h.Lots = append(h.Lots, Lot{Date: date, Shares: bought, Cost: bought.Value(close)})
+				} else if shares < h.Shares {
+					sold := h.Shares - shares
+					if h.Lots, err = p.sellLots(h, date, sold, sold.Value(close), &gains); err != nil {
+						return nil, err
+					}
+				}
+			} else {
+				h.Lots = nil
+			}
+
+			if shares > 0 {
+				h.Shares = shares
+				holdings = append(holdings, h)
+			}
+		}
+
+		// sell stocks which are not in the portfolio
+		for _, h := range a.Holdings {
+			if _, err := findTicker(p.Stocks, h.Stock.Ticker); err == nil || a.Type != Taxable {
+				continue
+			}
+			close, err := h.Stock.closeOn(date)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.sellLots(h, date, h.Shares, h.Shares.Value(close), &gains); err != nil {
+				return nil, err
+			}
+		}
+
+		a.Holdings = holdings
+		a.Cash = cash
+	}
+
+	return gains, nil
+}
+
+// fillAccounts places the amounts of the stocks, in order, in the
+// accounts until each account's capacity is used. Amounts and
+// capacity are reduced by the amounts placed.
+func fillAccounts(locations []Location, accounts []int, order []int, amounts, capacity []Money) {
+	for _, k := range accounts {
+		for _, i := range order {
+			amt := minMoney(amounts[i], capacity[k])
+			locations[k].Values[i] += amt
+			amounts[i] -= amt
+			capacity[k] -= amt
+		}
+	}
+}
+
+// sellLots removes shares of a holding sold for proceeds from its lots,
+// selected by the portfolio's LotMethod, adds the gains to gains and
+// returns the lots remaining.
+func (p *Portfolio) sellLots(h Holding, date Date, shares Quantity, proceeds Money, gains *[]RealizedGains) ([]Lot, error) {
+	return sellFromLots(h.Lots, p.LotMethod, p.LotSelector, h.Stock, date, shares, proceeds, gains)
+}
+
+// dragRate returns the tax on a stock's dividends and distributions over
+// the year before a date as a percent of its close on the date.
+func (tm *TaxModel) dragRate(stock *Stock, date Date, qualifiedPct float64) float64 {
+	idx := stock.getHistIdx(date, 0)
+	from := date.AddDate(-1, 0, 0)
+
+	dividends, distributions := 0.0, 0.0
+	for i := idx; i > 0 && stock.History[i].Date > from; i-- {
+		dividends += stock.History[i].Dividend.Float()
+		distributions += stock.History[i].Distribution.Float()
+	}
+
+	tax := dividends*(qualifiedPct*tm.QualifiedRate+(1-qualifiedPct)*tm.OrdinaryRate) +
+		distributions*tm.LongTermRate
+
+	return tax / stock.History[idx].Close.Float()
+}
+
+// expectedGrowth returns the annualized trailing return of a stock over
+// the five years, or else the one year, before a date.
+// Returns 0 if the stock does not have a year of history.
+func expectedGrowth(stock *Stock, date Date) float64 {
+	idx := stock.getHistIdx(date, 0)
+	view := []*Stock{{Ticker: stock.Ticker, History: stock.History[: idx+1 : idx+1]}}
+
+	if returns, ok := trailingReturns(view, date, 60); ok {
+		return math.Pow(1+returns[0], 1.0/5) - 1
+	}
+	if returns, ok := trailingReturns(view, date, 12); ok {
+		return returns[0]
+	}
+	return 0
+}
+
+// closeOn returns the close on or before a date.
+func (s *Stock) closeOn(date Date) (Price, error) {
+	if len(s.History) == 0 || s.History[0].Date > date {
+		return 0, fmt.Errorf("%s has no history on %s", s.Ticker, date)
+	}
+	return s.History[s.getHistIdx(date, 0)].Close, nil
+}
+
+// minMoney returns the smaller of two amounts.
+func minMoney(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
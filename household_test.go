@@ -0,0 +1,157 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+func TestHousehold(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+	date := MustParseDate("2020-06-01")
+	bought := MustParseDate("2019-01-02")
+
+	p := NewPortfolio("household")
+	p.Tax = &TaxModel{QualifiedRate: .15, OrdinaryRate: .3, ShortTermRate: .3, LongTermRate: .15}
+	p.AddStock(fxaix, .6)
+	p.AddStock(fxnax, .4)
+	p.SetStockOptions("FXAIX", StockOptions{QualifiedPct: .9})
+
+	if err := p.AddStock(fxaix, .1); err == nil {
+		t.Error("missed error adding stock twice")
+	}
+
+	// bonds in the taxable account and stocks in the IRAs
+	brokerage, _ := p.AddAccount("brokerage", Taxable)
+	ira, _ := p.AddAccount("ira", TraditionalIRA)
+	roth, _ := p.AddAccount("roth", Roth)
+
+	if _, err := p.AddAccount("roth", Roth); err == nil {
+		t.Error("missed error duplicate account")
+	}
+
+	buy := func(a *Account, stock *Stock, amt float64) {
+		close, _ := stock.closeOn(bought)
+		shares := close.Shares(NewMoney(amt), 3)
+		a.AddHolding(stock, shares, []Lot{{Date: bought, Shares: shares, Cost: shares.Value(close)}})
+	}
+	buy(brokerage, fxnax, 60000)
+	buy(ira, fxaix, 25000)
+	buy(roth, fxaix, 15000)
+
+	before, err := p.Value(date)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dragBefore, _ := p.TaxDrag(date)
+
+	locations, err := p.Locate(date)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// bonds are sheltered first and the accounts are not overfilled
+	for _, loc := range locations {
+		value, _ := loc.Account.Value(date)
+		if loc.Values[0]+loc.Values[1] > value {
+			t.Errorf("%s located %v more than value %s", loc.Account.Name, loc.Values, value)
+		}
+	}
+
+	// the stocks which do fit in the IRAs are put in the Roth
+	if locations[1].Values[0] != 0 || locations[2].Values[0] == 0 {
+		t.Errorf("stocks not in Roth: %v %v", locations[1].Values, locations[2].Values)
+	}
+	if locations[0].Values[1] != 0 {
+		t.Errorf("bonds in taxable account: %v", locations[0].Values)
+	}
+
+	gains, err := p.Rebalance(date)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	after, _ := p.Value(date)
+	if after != before {
+		t.Errorf("value changed from %s to %s", before, after)
+	}
+
+	dragAfter, _ := p.TaxDrag(date)
+	if dragAfter >= dragBefore {
+		t.Errorf("tax drag not reduced: %s to %s", dragBefore, dragAfter)
+	}
+
+	if len(gains) != 1 || gains[0].LongTerm == 0 {
+		t.Errorf("gains from selling bonds not realized: %+v", gains)
+	}
+
+	// household allocation is unchanged
+	for i, stock := range p.Stocks {
+		close, _ := stock.closeOn(date)
+		value := Money(0)
+		for _, a := range p.Accounts {
+			if h := a.findHolding(stock.Ticker); h != nil {
+				value += h.Shares.Value(close)
+			}
+		}
+		if pct := value.Float() / after.Float(); pct < p.PctHolding[i]-.001 || pct > p.PctHolding[i]+.001 {
+			t.Errorf("%s is %g of portfolio, expected %g", stock.Ticker, pct, p.PctHolding[i])
+		}
+	}
+
+	h := brokerage.findHolding("FXAIX")
+	if len(h.Lots) != 1 || h.Lots[0].Shares != h.Shares || h.Lots[0].Date != date {
+		t.Errorf("taxable lots not updated: %+v", h)
+	}
+	if bonds := ira.findHolding("FXNAX"); bonds == nil || len(bonds.Lots) != 0 {
+		t.Error("lots kept in IRA")
+	}
+
+	if _, err := p.Locate(MustParseDate("2000-01-03")); err == nil {
+		t.Error("missed error date before history")
+	}
+}
+
+func TestHouseholdLotMethod(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+	date := MustParseDate("2020-06-01")
+
+	rebalance := func(method LotMethod, lots []Lot) ([]RealizedGains, error) {
+		p := NewPortfolio("household")
+		p.LotMethod = method
+		p.Tax = &TaxModel{QualifiedRate: .15, OrdinaryRate: .3, ShortTermRate: .3, LongTermRate: .15}
+		p.AddStock(fxaix, .5)
+		p.AddStock(fxnax, .5)
+
+		a, _ := p.AddAccount("brokerage", Taxable)
+		a.AddHolding(fxaix, NewQuantity(100), lots)
+		return p.Rebalance(date)
+	}
+
+	// an old cheap lot and a new expensive lot
+	lots := []Lot{
+		{Date: MustParseDate("2016-01-04"), Shares: NewQuantity(50), Cost: NewMoney(3000)},
+		{Date: MustParseDate("2020-02-03"), Shares: NewQuantity(50), Cost: NewMoney(6000)},
+	}
+
+	fifo, err := rebalance(FIFO, lots)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hifo, err := rebalance(HIFO, lots)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fifo[0].LongTerm <= 0 || fifo[0].ShortTerm != 0 {
+		t.Errorf("FIFO gains %+v, expected long term", fifo)
+	}
+	if hifo[0].ShortTerm == 0 || hifo[0].LongTerm != 0 {
+		t.Errorf("HIFO gains %+v, expected short term", hifo)
+	}
+
+	lots = []Lot{{Date: MustParseDate("2016-01-04"), Shares: NewQuantity(10), Cost: NewMoney(600)}}
+	if _, err := rebalance(FIFO, lots); err == nil {
+		t.Error("missed error selling shares not in lots")
+	}
+}
@@ -0,0 +1,506 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FidelityPositions maps the columns of a Fidelity positions export.
+var FidelityPositions = ColumnMap{
+	Account:     "Account Name",
+	Symbol:      "Symbol",
+	Quantity:    "Quantity",
+	CostBasis:   "Cost Basis Total",
+	Value:       "Current Value",
+	CashSymbols: []string{"SPAXX", "FDRXX", "FZFXX", "CORE"},
+}
+
+// FidelityTransactions maps the columns of a Fidelity account history export.
+var FidelityTransactions = ColumnMap{
+	Account:     "Account",
+	Date:        "Run Date",
+	Action:      "Action",
+	Symbol:      "Symbol",
+	Quantity:    "Quantity",
+	Price:       "Price ($)",
+	Amount:      "Amount ($)",
+	CashSymbols: []string{"SPAXX", "FDRXX", "FZFXX", "CORE"},
+}
+
+// SchwabPositions maps the columns of a Schwab positions export.
+var SchwabPositions = ColumnMap{
+	Symbol:      "Symbol",
+	Quantity:    "Quantity",
+	CostBasis:   "Cost Basis",
+	Value:       "Market Value",
+	CashSymbols: []string{"Cash & Cash Investments"},
+}
+
+// SchwabTransactions maps the columns of a Schwab transactions export.
+var SchwabTransactions = ColumnMap{
+	Date:     "Date",
+	Action:   "Action",
+	Symbol:   "Symbol",
+	Quantity: "Quantity",
+	Price:    "Price",
+	Amount:   "Amount",
+}
+
+// ImportPositions adds the holdings and cash in a positions export to the
+// portfolio's accounts. Holdings are put in the account named in the
+// Account column, or in account if there is no Account column. Accounts
+// not already in the portfolio are added as Taxable accounts.
+//
+// Each holding is given one lot bought on the Acquired date, or on date
+// if there is no Acquired column. If there is no cost basis, the cost
+// is the value of the shares at the close on the lot date.
+func (p *Portfolio) ImportPositions(file string, date Date, account string, cols ColumnMap) error {
+	rows, err := readCSVFile(file)
+	if err != nil {
+		return err
+	}
+
+	header, idx, err := findColumns(rows, []string{cols.Symbol, cols.Quantity},
+		cols.Account, cols.CostBasis, cols.Value, cols.Acquired)
+	if err != nil {
+		return fmt.Errorf("positions file %s: %v", file, err)
+	}
+
+	for i := header + 1; i < len(rows); i++ {
+		// skip notes after the positions
+		if len(rows[i]) < len(rows[header]) {
+			continue
+		}
+
+		if err := p.importPosition(rows[i], idx, date, account, cols); err != nil {
+			return fmt.Errorf("positions file %s, line %d, %v", file, i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// importPosition adds the holding or cash in one row of a positions export.
+func (p *Portfolio) importPosition(row []string, idx map[string]int, date Date, account string, cols ColumnMap) error {
+	symbol := cell(row, idx, cols.Symbol)
+	quantity := cell(row, idx, cols.Quantity)
+	if symbol == "" {
+		return nil
+	}
+
+	a, err := p.importAccount(cell(row, idx, cols.Account), account)
+	if err != nil {
+		return err
+	}
+
+	if cols.isCash(symbol) {
+		value := cell(row, idx, cols.Value)
+		if value == "" {
+			value = quantity
+		}
+		cash, err := ParseMoney(value)
+		if err != nil {
+			return err
+		}
+		a.Cash += cash
+		return nil
+	}
+
+	// skip totals and pending activity
+	if quantity == "" {
+		return nil
+	}
+
+	shares, err := ParseQuantity(quantity)
+	if err != nil {
+		return err
+	}
+
+	stock, err := p.findStock(strings.TrimRight(symbol, "*"))
+	if err != nil {
+		return err
+	}
+
+	lot := Lot{Date: date, Shares: shares}
+	if acquired := cell(row, idx, cols.Acquired); acquired != "" {
+		if lot.Date, err = parseExportDate(acquired); err != nil {
+			return err
+		}
+	}
+
+	if basis := cell(row, idx, cols.CostBasis); basis != "" {
+		if lot.Cost, err = ParseMoney(basis); err != nil {
+			return err
+		}
+	} else {
+		close, err := stock.closeOn(lot.Date)
+		if err != nil {
+			return err
+		}
+		lot.Cost = shares.Value(close)
+	}
+
+	a.AddHolding(stock, shares, []Lot{lot})
+	return nil
+}
+
+// ImportTransactions replays the transactions in a transactions export,
+// in date order, on the portfolio's accounts. Transactions are put in the
+// account named in the Account column, or in account if there is no
+// Account column. Accounts not already in the portfolio are added as
+// Taxable accounts.
+//
+// Buys add a lot at the Amount, or else the shares times the Price, or
+// else the close on the date. Sells remove shares from the oldest lots
+// and add the gains to the account's Gains. Buys and sells of CashSymbols
+// do not change the account. Accounts should not also have positions
+// imported, since the transactions build the holdings.
+func (p *Portfolio) ImportTransactions(file, account string, cols ColumnMap) error {
+	rows, err := readCSVFile(file)
+	if err != nil {
+		return err
+	}
+
+	header, idx, err := findColumns(rows, []string{cols.Date, cols.Action, cols.Amount},
+		cols.Account, cols.Symbol, cols.Quantity, cols.Price)
+	if err != nil {
+		return fmt.Errorf("transactions file %s: %v", file, err)
+	}
+
+	var trans []Transaction
+	var lines []int
+	for i := header + 1; i < len(rows); i++ {
+		// skip totals and notes after the transactions
+		if len(rows[i]) < len(rows[header]) || cell(rows[i], idx, cols.Action) == "" {
+			continue
+		}
+
+		t, err := parseTransaction(rows[i], idx, account, cols)
+		if err != nil {
+			return fmt.Errorf("transactions file %s, line %d, %v", file, i+1, err)
+		}
+		trans = append(trans, t)
+		lines = append(lines, i+1)
+	}
+
+	// exports are usually newest first
+	if len(trans) > 1 && trans[0].Date > trans[len(trans)-1].Date {
+		for a, b := 0, len(trans)-1; a < b; a, b = a+1, b-1 {
+			trans[a], trans[b] = trans[b], trans[a]
+			lines[a], lines[b] = lines[b], lines[a]
+		}
+	}
+
+	order := make([]int, len(trans))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return trans[order[a]].Date < trans[order[b]].Date
+	})
+
+	for _, i := range order {
+		if err := p.applyTransaction(trans[i], cols); err != nil {
+			return fmt.Errorf("transactions file %s, line %d, %v", file, lines[i], err)
+		}
+	}
+
+	// drop holdings which were sold
+	for _, a := range p.Accounts {
+		kept := a.Holdings[:0]
+		for _, h := range a.Holdings {
+			if h.Shares != 0 {
+				kept = append(kept, h)
+			}
+		}
+		a.Holdings = kept
+	}
+
+	return nil
+}
+
+// parseTransaction returns the transaction in one row of a transactions export.
+func parseTransaction(row []string, idx map[string]int, account string, cols ColumnMap) (Transaction, error) {
+	var t Transaction
+	var err error
+
+	t.Account = cell(row, idx, cols.Account)
+	if t.Account == "" {
+		t.Account = account
+	}
+	if t.Account == "" {
+		return t, errors.New("no account")
+	}
+
+	if t.Date, err = parseExportDate(cell(row, idx, cols.Date)); err != nil {
+		return t, err
+	}
+
+	t.Ticker = strings.TrimRight(cell(row, idx, cols.Symbol), "*")
+
+	if amount := cell(row, idx, cols.Amount); amount != "" {
+		if t.Amount, err = ParseMoney(amount); err != nil {
+			return t, err
+		}
+	}
+
+	if quantity := cell(row, idx, cols.Quantity); quantity != "" {
+		if t.Shares, err = ParseQuantity(quantity); err != nil {
+			return t, err
+		}
+		if t.Shares < 0 {
+			t.Shares = -t.Shares
+		}
+	}
+
+	if price := cell(row, idx, cols.Price); price != "" {
+		if t.Price, err = ParsePrice(price); err != nil {
+			return t, err
+		}
+	}
+
+	t.Action = cols.action(cell(row, idx, cols.Action))
+
+	if t.Action == Buy || t.Action == Sell {
+		if t.Amount < 0 {
+			t.Amount = -t.Amount
+		}
+		if t.Ticker == "" {
+			return t, errors.New("no symbol for buy or sell")
+		}
+	}
+
+	return t, nil
+}
+
+// applyTransaction changes the holdings and cash of the account of a
+// transaction and adds the transaction to the account.
+func (p *Portfolio) applyTransaction(t Transaction, cols ColumnMap) error {
+	a, err := p.importAccount(t.Account, "")
+	if err != nil {
+		return err
+	}
+
+	cash := cols.isCash(t.Ticker)
+
+	switch {
+	case t.Action == Income || t.Action == Transfer:
+		a.Cash += t.Amount
+
+	case t.Action == Buy && !cash:
+		stock, err := p.findStock(t.Ticker)
+		if err != nil {
+			return err
+		}
+		if t.Amount, err = tradeAmount(t, stock); err != nil {
+			return err
+		}
+		a.AddHolding(stock, t.Shares, []Lot{{Date: t.Date, Shares: t.Shares, Cost: t.Amount}})
+		a.Cash -= t.Amount
+
+	case t.Action == Sell && !cash:
+		h := a.findHolding(t.Ticker)
+		if h == nil || h.Shares < t.Shares {
+			return fmt.Errorf("selling %s shares of %s, more than held", t.Shares, t.Ticker)
+		}
+		if t.Amount, err = tradeAmount(t, h.Stock); err != nil {
+			return err
+		}
+		if h.Lots, err = p.sellLots(*h, t.Date, t.Shares, t.Amount, &a.Gains); err != nil {
+			return err
+		}
+		h.Shares -= t.Shares
+		a.Cash += t.Amount
+	}
+
+	a.Transactions = append(a.Transactions, t)
+	return nil
+}
+
+// tradeAmount returns the amount of a buy or sell transaction. Without
+// an amount, it is the value of the shares at the transaction's price,
+// or else at the stock's close on the transaction date.
+func tradeAmount(t Transaction, stock *Stock) (Money, error) {
+	if t.Amount != 0 {
+		return t.Amount, nil
+	}
+
+	price := t.Price
+	if price == 0 {
+		var err error
+		if price, err = stock.closeOn(t.Date); err != nil {
+			return 0, err
+		}
+	}
+	return t.Shares.Value(price), nil
+}
+
+// importAccount returns the account named name, or else named account,
+// adding it to the portfolio as a Taxable account if needed.
+func (p *Portfolio) importAccount(name, account string) (*Account, error) {
+	if name == "" {
+		name = account
+	}
+	if name == "" {
+		return nil, errors.New("no account")
+	}
+
+	if a := p.Account(name); a != nil {
+		return a, nil
+	}
+	return p.AddAccount(name, Taxable)
+}
+
+// findStock returns the stock for a ticker from the portfolio's stocks or
+// holdings, or else reads its history.
+func (p *Portfolio) findStock(ticker string) (*Stock, error) {
+	if i, err := findTicker(p.Stocks, ticker); err == nil {
+		return p.Stocks[i], nil
+	}
+
+	for _, a := range p.Accounts {
+		if h := a.findHolding(ticker); h != nil {
+			return h.Stock, nil
+		}
+	}
+
+	stock, err := NewStock(ticker)
+	if err != nil {
+		return nil, fmt.Errorf("no history for %s: %v", ticker, err)
+	}
+	return stock, nil
+}
+
+// findHolding returns the holding of a stock, or nil if it is not held.
+func (a *Account) findHolding(ticker string) *Holding {
+	for i := range a.Holdings {
+		if a.Holdings[i].Stock.Ticker == ticker {
+			return &a.Holdings[i]
+		}
+	}
+	return nil
+}
+
+// action returns the action for the text in the Action column.
+func (cols ColumnMap) action(text string) TransactionAction {
+	for name, action := range cols.Actions {
+		if strings.EqualFold(name, text) {
+			return action
+		}
+	}
+
+	text = strings.ToUpper(text)
+	switch {
+	case strings.HasPrefix(text, "REINVEST DIVIDEND"):
+		return Income
+	case containsAny(text, "BOUGHT", "BUY", "REINVEST"):
+		return Buy
+	case containsAny(text, "SOLD", "SELL"):
+		return Sell
+	case containsAny(text, "DIVIDEND", "INTEREST", "DISTRIBUTION", "CAP GAIN"):
+		return Income
+	case containsAny(text, "CONTRIBUTION", "DEPOSIT", "WITHDRAWAL", "TRANSFER", "MONEYLINK"):
+		return Transfer
+	}
+	return Ignored
+}
+
+// String returns the name of an action.
+func (a TransactionAction) String() string {
+	switch a {
+	case Buy:
+		return "Buy"
+	case Sell:
+		return "Sell"
+	case Income:
+		return "Income"
+	case Transfer:
+		return "Transfer"
+	}
+	return "Ignored"
+}
+
+// isCash returns true if a symbol is one of the CashSymbols.
+func (cols ColumnMap) isCash(symbol string) bool {
+	symbol = strings.TrimRight(symbol, "*")
+	for _, cash := range cols.CashSymbols {
+		if strings.EqualFold(cash, symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+// findColumns returns the index of the header row, the first row which
+// contains all of the required columns and any other named columns, and
+// the index of each named column.
+func findColumns(rows [][]string, required []string, optional ...string) (int, map[string]int, error) {
+	for _, name := range required {
+		if name == "" {
+			return 0, nil, errors.New("required column not mapped")
+		}
+	}
+
+	names := required
+	for _, name := range optional {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	for i, row := range rows {
+		idx := make(map[string]int)
+		for col, name := range row {
+			name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+			idx[name] = col
+		}
+
+		found := true
+		for _, name := range names {
+			if _, ok := idx[name]; !ok {
+				found = false
+			}
+		}
+		if found {
+			return i, idx, nil
+		}
+	}
+
+	return 0, nil, fmt.Errorf("no header row with columns %s", strings.Join(names, ", "))
+}
+
+// cell returns the trimmed value in a row of a named column, or "" if the
+// column is not named or the row is too short. "--" is returned as "".
+func cell(row []string, idx map[string]int, name string) string {
+	col, ok := idx[name]
+	if name == "" || !ok || col >= len(row) {
+		return ""
+	}
+
+	value := strings.TrimSpace(row[col])
+	if value == "--" || value == "n/a" {
+		return ""
+	}
+	return value
+}
+
+// parseExportDate parses a date which may be followed
+// by another date, such as "06/01/2020 as of 05/29/2020".
+func parseExportDate(text string) (Date, error) {
+	if i := strings.Index(text, " as of "); i >= 0 {
+		text = text[:i]
+	}
+	return ParseDate(text)
+}
+
+// containsAny returns true if text contains any of the words.
+func containsAny(text string, words ...string) bool {
+	for _, word := range words {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+func TestImportPositions(t *testing.T) {
+	p := NewPortfolio("household")
+	roth, _ := p.AddAccount("Roth IRA", Roth)
+	date := MustParseDate("2021-06-01")
+
+	if err := p.ImportPositions("testdata/positions.csv", date, "", FidelityPositions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	brokerage := p.Account("Brokerage")
+	if brokerage == nil || brokerage.Type != Taxable || len(p.Accounts) != 2 {
+		t.Fatalf("accounts not added: %+v", p.Accounts)
+	}
+
+	if brokerage.Cash != NewMoney(1250.50) {
+		t.Errorf("cash %s, expected 1,250.50", brokerage.Cash)
+	}
+
+	h := brokerage.findHolding("FXAIX")
+	if h == nil || h.Shares != NewQuantity(100) || len(h.Lots) != 1 || h.Lots[0].Cost != NewMoney(9500) {
+		t.Fatalf("FXAIX holding not imported: %+v", h)
+	}
+
+	// no cost basis uses the close on the date
+	bond := roth.findHolding("FXNAX")
+	close, _ := bond.Stock.closeOn(date)
+	if bond.Shares != NewQuantity(200.5) || bond.Lots[0].Cost != bond.Shares.Value(close) {
+		t.Errorf("FXNAX holding not imported: %+v", bond)
+	}
+
+	if value, err := p.Value(date); err != nil || value <= brokerage.Cash {
+		t.Errorf("portfolio value %s, %v", value, err)
+	}
+
+	cols := FidelityPositions
+	cols.Quantity = "Shares"
+	if err := p.ImportPositions("testdata/positions.csv", date, "", cols); err == nil {
+		t.Error("missed error missing column")
+	}
+}
+
+func TestImportTransactions(t *testing.T) {
+	p := NewPortfolio("household")
+
+	if err := p.ImportTransactions("testdata/transactions.csv", "", SchwabTransactions); err == nil {
+		t.Error("missed error no account")
+	}
+
+	p = NewPortfolio("household")
+	if err := p.ImportTransactions("testdata/transactions.csv", "Brokerage", SchwabTransactions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a := p.Account("Brokerage")
+	if len(a.Transactions) != 7 {
+		t.Fatalf("%d transactions, expected 7", len(a.Transactions))
+	}
+
+	for i := 1; i < len(a.Transactions); i++ {
+		if a.Transactions[i].Date < a.Transactions[i-1].Date {
+			t.Fatalf("transactions not in date order: %+v", a.Transactions)
+		}
+	}
+
+	if a.Cash != NewMoney(3400) {
+		t.Errorf("cash %s, expected 3,400.00", a.Cash)
+	}
+
+	// the oldest lot is sold first
+	stock := a.findHolding("FXAIX")
+	if stock.Shares != NewQuantity(70) || len(stock.Lots) != 2 || stock.Lots[0].Cost != NewMoney(1600) {
+		t.Errorf("FXAIX lots not sold: %+v", stock)
+	}
+
+	bond := a.findHolding("FXNAX")
+	if bond.Shares != NewQuantity(101.5) || len(bond.Lots) != 2 {
+		t.Errorf("FXNAX not bought: %+v", bond)
+	}
+
+	if len(a.Gains) != 1 || a.Gains[0].Year != 2020 || a.Gains[0].LongTerm != NewMoney(1200) {
+		t.Errorf("gains %+v, expected 2020 long term 1,200.00", a.Gains)
+	}
+}
+
+func TestImportTransactionsNoPrice(t *testing.T) {
+	p := NewPortfolio("household")
+	if err := p.ImportTransactions("testdata/transactions_noprice.csv", "Brokerage", SchwabTransactions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the sell without a price or amount is at the close
+	stock, _ := NewStock("FXAIX")
+	close, err := stock.closeOn(MustParseDate("2020-12-15"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	proceeds := NewQuantity(30).Value(close)
+
+	a := p.Account("Brokerage")
+	if want := NewMoney(6000) + proceeds; a.Cash != want {
+		t.Errorf("cash %s, expected %s", a.Cash, want)
+	}
+	if len(a.Gains) != 1 || a.Gains[0].LongTerm != proceeds-NewMoney(2400) {
+		t.Errorf("gains %+v, expected long term %s", a.Gains, proceeds-NewMoney(2400))
+	}
+}
+
+func TestTransactionAction(t *testing.T) {
+	cols := ColumnMap{Actions: map[string]TransactionAction{"Journal": Transfer}}
+
+	tests := []struct {
+		text   string
+		action TransactionAction
+	}{
+		{"YOU BOUGHT FIDELITY 500 INDEX FUND (FXAIX)", Buy},
+		{"REINVESTMENT VANGUARD DIVIDEND APPRECIATION ETF (VIG)", Buy},
+		{"Reinvest Dividend", Income},
+		{"YOU SOLD FIDELITY 500 INDEX FUND (FXAIX)", Sell},
+		{"DIVIDEND RECEIVED FIDELITY 500 INDEX FUND (FXAIX)", Income},
+		{"Electronic Funds Transfer Received (Cash)", Transfer},
+		{"journal", Transfer},
+		{"Stock Split", Ignored},
+	}
+
+	for _, test := range tests {
+		if action := cols.action(test.text); action != test.action {
+			t.Errorf("%s: action %d, expected %d", test.text, action, test.action)
+		}
+	}
+}
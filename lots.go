@@ -0,0 +1,162 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// addLot adds a tax lot for stock i.
+func (sc *StockScenario) addLot(i int, lot Lot) {
+	sc.Lots[i] = append(sc.Lots[i], lot)
+}
+
+// sellLots removes shares of stock i from its tax lots, selected by the
+// scenario's LotMethod, and adds the gains to the realized gains for the
+// year of the sale date.
+func (sc *StockScenario) sellLots(i int, date Date, shares Quantity, price Price) error {
+	lots, err := sellFromLots(sc.Lots[i], sc.LotMethod, sc.LotSelector, sc.Stocks[i],
+		date, shares, shares.Value(price), &sc.Gains)
+	if err != nil {
+		return err
+	}
+	sc.Lots[i] = lots
+	return nil
+}
+
+// sellFromLots removes shares of a stock sold for proceeds from its tax
+// lots, selected by a LotMethod, and adds the gains to the gains for the
+// year of the sale date. The proceeds are shared by the lots sold in
+// proportion to their shares. It returns the lots remaining, or an error
+// if the lots selected do not cover the shares.
+func sellFromLots(lots []Lot, method LotMethod, selector LotSelector, stock *Stock,
+	date Date, shares Quantity, proceeds Money, gains *[]RealizedGains) ([]Lot, error) {
+
+	order, err := lotOrder(lots, method, selector, stock, date, shares)
+	if err != nil {
+		return nil, err
+	}
+
+	lots = append([]Lot(nil), lots...)
+	remaining := shares
+	for _, idx := range order {
+		if remaining == 0 {
+			break
+		}
+
+		lot := &lots[idx]
+		sold := lot.Shares
+		if sold > remaining {
+			sold = remaining
+		}
+
+		cost := lot.Cost
+		if sold < lot.Shares {
+			cost = Money(mulDivRound(int64(lot.Cost), int64(sold), int64(lot.Shares)))
+		}
+
+		// the last lot sold gets the proceeds left
+		lotProceeds := proceeds
+		if sold < remaining {
+			lotProceeds = Money(mulDivRound(int64(proceeds), int64(sold), int64(remaining)))
+		}
+
+		addGain(gains, date, lot.Date, lotProceeds-cost)
+
+		lot.Shares -= sold
+		lot.Cost -= cost
+		remaining -= sold
+		proceeds -= lotProceeds
+	}
+
+	if remaining != 0 {
+		return nil, fmt.Errorf("%s on %s: selling %s shares more than the lots selected",
+			stock.Ticker, date, remaining)
+	}
+
+	// drop lots which have been completely sold
+	kept := lots[:0]
+	for _, lot := range lots {
+		if lot.Shares > 0 {
+			kept = append(kept, lot)
+		}
+	}
+	return kept, nil
+}
+
+// sellAllLots sells all of the tax lots of stock i.
+func (sc *StockScenario) sellAllLots(i int, date Date, price Price) {
+	for _, lot := range sc.Lots[i] {
+		sc.addGain(date, lot.Date, lot.Shares.Value(price)-lot.Cost)
+	}
+	sc.Lots[i] = nil
+}
+
+// lotOrder returns the indexes of the lots of a stock in the order
+// they should be sold by a LotMethod.
+func lotOrder(lots []Lot, method LotMethod, selector LotSelector, stock *Stock, date Date, shares Quantity) ([]int, error) {
+	if method == SpecificLots {
+		if selector == nil {
+			return nil, errors.New("LotSelector not set for SpecificLots")
+		}
+		order := selector(date, stock, lots, shares)
+		for _, idx := range order {
+			if idx < 0 || idx >= len(lots) {
+				return nil, fmt.Errorf("%s on %s: LotSelector returned invalid lot %d",
+					stock.Ticker, date, idx)
+			}
+		}
+		return order, nil
+	}
+
+	// lots are added in date order
+	order := make([]int, len(lots))
+	for idx := range order {
+		order[idx] = idx
+	}
+
+	switch method {
+	case LIFO:
+		for a, b := 0, len(order)-1; a < b; a, b = a+1, b-1 {
+			order[a], order[b] = order[b], order[a]
+		}
+	case HIFO:
+		sort.SliceStable(order, func(a, b int) bool {
+			return lots[order[a]].costPerShare() > lots[order[b]].costPerShare()
+		})
+	}
+
+	return order, nil
+}
+
+// costPerShare returns the cost basis per share of a lot.
+func (l Lot) costPerShare() float64 {
+	return l.Cost.Float() / l.Shares.Float()
+}
+
+// longTerm returns true if a lot bought on a date and sold on
+// another date was held for more than a year.
+func longTerm(bought, sold Date) bool {
+	return sold > bought.AddDate(1, 0, 0)
+}
+
+// addGain adds a realized gain, or loss, to the gains for the year it was sold.
+func (sc *StockScenario) addGain(sold, bought Date, gain Money) {
+	addGain(&sc.Gains, sold, bought, gain)
+}
+
+// addGain adds a realized gain, or loss, to gains for the year it was sold.
+// Gains are in year order and sales must be in date order.
+func addGain(gains *[]RealizedGains, sold, bought Date, gain Money) {
+	year := sold.Year()
+	if len(*gains) == 0 || (*gains)[len(*gains)-1].Year != year {
+		*gains = append(*gains, RealizedGains{Year: year})
+	}
+
+	g := &(*gains)[len(*gains)-1]
+	if longTerm(bought, sold) {
+		g.LongTerm += gain
+	} else {
+		g.ShortTerm += gain
+	}
+}
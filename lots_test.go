@@ -0,0 +1,132 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+func TestSellLots(t *testing.T) {
+	sc := &StockScenario{Stocks: []*Stock{{Ticker: "XXX"}}, Lots: make([][]Lot, 1)}
+	sc.addLot(0, Lot{Date: MustParseDate("2019-01-02"), Shares: NewQuantity(10), Cost: NewMoney(100)})
+	sc.addLot(0, Lot{Date: MustParseDate("2019-06-03"), Shares: NewQuantity(10), Cost: NewMoney(300)})
+	sc.addLot(0, Lot{Date: MustParseDate("2020-01-02"), Shares: NewQuantity(10), Cost: NewMoney(200)})
+
+	// FIFO: 10 shares long term gain of 150, 5 shares short term loss of 25
+	if err := sc.sellLots(0, MustParseDate("2020-03-02"), NewQuantity(15), NewPrice(25)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sc.Gains) != 1 || sc.Gains[0].Year != 2020 ||
+		sc.Gains[0].LongTerm != NewMoney(150) || sc.Gains[0].ShortTerm != NewMoney(-25) {
+		t.Errorf("invalid FIFO gains: %+v", sc.Gains)
+	}
+
+	if len(sc.Lots[0]) != 2 || sc.Lots[0][0].Shares != NewQuantity(5) || sc.Lots[0][0].Cost != NewMoney(150) {
+		t.Errorf("invalid lots after FIFO: %+v", sc.Lots[0])
+	}
+
+	// HIFO: remaining 5 shares at 30 per share, then 5 of the 20 per share lot
+	sc.LotMethod = HIFO
+	if err := sc.sellLots(0, MustParseDate("2021-03-01"), NewQuantity(10), NewPrice(25)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	g := sc.Gains[1]
+	if g.Year != 2021 || g.ShortTerm != 0 || g.LongTerm != 0 {
+		t.Errorf("invalid HIFO gains: %+v", g)
+	}
+
+	if len(sc.Lots[0]) != 1 || sc.Lots[0][0].Shares != NewQuantity(5) || sc.Lots[0][0].Cost != NewMoney(100) {
+		t.Errorf("invalid lots after HIFO: %+v", sc.Lots[0])
+	}
+
+	if err := sc.sellLots(0, MustParseDate("2021-03-01"), NewQuantity(6), NewPrice(25)); err == nil {
+		t.Error("missed error selling more shares than in lots")
+	}
+}
+
+func TestLotMethods(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+
+	run := func(method LotMethod, selector LotSelector) *StockScenario {
+		sc := NewStockScenario(MustParseDate("2016-01-01"), MustParseDate("2020-12-31"))
+		sc.AddStock(fxaix, .6)
+		sc.AddStock(fxnax, .4)
+		sc.LotMethod = method
+		sc.LotSelector = selector
+		if err := sc.CalcResults(10000); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return sc
+	}
+
+	// total of realized gains plus unrealized gains
+	totalGain := func(sc *StockScenario) Money {
+		total := Money(0)
+		for _, g := range sc.Gains {
+			total += g.ShortTerm + g.LongTerm
+		}
+
+		last := sc.Results[len(sc.Results)-1]
+		for i, stock := range sc.Stocks {
+			total += last.Shares[i].Value(stock.History[last.StockHistIdx[i]].Close)
+			for _, lot := range sc.Lots[i] {
+				total -= lot.Cost
+			}
+		}
+		return total
+	}
+
+	fifo := run(FIFO, nil)
+
+	// lots hold all of the shares
+	last := fifo.Results[len(fifo.Results)-1]
+	for i := range fifo.Stocks {
+		shares := Quantity(0)
+		for _, lot := range fifo.Lots[i] {
+			shares += lot.Shares
+		}
+		if shares != last.Shares[i] {
+			t.Errorf("%s lots hold %s shares not %s", fifo.Stocks[i].Ticker, shares, last.Shares[i])
+		}
+	}
+
+	if len(fifo.Gains) != 5 {
+		t.Errorf("expected gains for 5 years: %+v", fifo.Gains)
+	}
+
+	hifo := run(HIFO, nil)
+	lifo := run(LIFO, nil)
+	specific := run(SpecificLots, func(date Date, stock *Stock, lots []Lot, shares Quantity) []int {
+		order := []int{}
+		for i := len(lots) - 1; i >= 0; i-- {
+			order = append(order, i)
+		}
+		return order
+	})
+
+	if hifo.Gains[4] == fifo.Gains[4] {
+		t.Error("HIFO gains same as FIFO")
+	}
+
+	for i := range lifo.Gains {
+		if lifo.Gains[i] != specific.Gains[i] {
+			t.Errorf("specific lots newest first not same as LIFO: %+v %+v", lifo.Gains[i], specific.Gains[i])
+		}
+	}
+
+	// lot method only changes when gains are realized, within rounding
+	for _, sc := range []*StockScenario{hifo, lifo} {
+		diff := totalGain(sc) - totalGain(fifo)
+		if diff < -100 || diff > 100 {
+			t.Errorf("total gain %s differs from FIFO %s", totalGain(sc), totalGain(fifo))
+		}
+	}
+
+	sc := NewStockScenario(MustParseDate("2016-01-01"), MustParseDate("2020-12-31"))
+	sc.AddStock(fxaix, 1)
+	sc.LotMethod = SpecificLots
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error SpecificLots without LotSelector")
+	}
+}
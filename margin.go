@@ -0,0 +1,48 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// validate verifies the margin settings.
+func (m *Margin) validate() error {
+
+	if m.MaxGross < 1 {
+		return errors.New("margin MaxGross less than 1")
+	}
+
+	if m.Maintenance <= 0 || m.Maintenance >= 1 {
+		return errors.New("margin Maintenance not between 0 and 1")
+	}
+
+	// equity at MaxGross must be above the maintenance requirement
+	if 1/m.MaxGross <= m.Maintenance {
+		return fmt.Errorf("margin MaxGross %g below Maintenance %g at the start", m.MaxGross, m.Maintenance)
+	}
+
+	if len(m.Rates) == 0 {
+		return errors.New("margin has no interest rates")
+	}
+
+	for i, rate := range m.Rates {
+		if i > 0 && rate.Date <= m.Rates[i-1].Date {
+			return fmt.Errorf("margin rate %d date %s not after %s", i, rate.Date, m.Rates[i-1].Date)
+		}
+	}
+
+	return nil
+}
+
+// rateOn returns the interest rate in effect on a date. The first rate
+// is used for dates before the first rate date.
+func (m *Margin) rateOn(date Date) float64 {
+	rate := m.Rates[0].Rate
+	for _, r := range m.Rates {
+		if r.Date > date {
+			break
+		}
+		rate = r.Rate
+	}
+	return rate
+}
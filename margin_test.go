@@ -0,0 +1,71 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMargin(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+
+	sc := NewStockScenario(MustParseDate("2019-01-01"), MustParseDate("2019-12-31"))
+	if err := sc.AddStock(fxaix, 1.2); err == nil {
+		t.Error("missed error pct > 1 without margin")
+	}
+
+	sc.Margin = &Margin{MaxGross: 1.5, Maintenance: .25, Rates: []RatePoint{{Date: MustParseDate("2000-01-01"), Rate: .03}}}
+	if err := sc.AddStock(fxaix, 1.6); err == nil {
+		t.Error("missed error pct > MaxGross")
+	}
+	sc.AddStock(fxaix, 1.2)
+	sc.AddStock(fxnax, .3)
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first := sc.Results[0]
+	if math.Abs(first.Loan.Float()-5000) > 1 {
+		t.Errorf("first loan %s not 5000", first.Loan)
+	}
+
+	// 3% of a loan starting at 5,000 and growing with the equity
+	if sc.Interest < NewMoney(150) || sc.Interest > NewMoney(200) {
+		t.Errorf("interest %s not between 150 and 200", sc.Interest)
+	}
+
+	if sc.MarginCalls != 0 {
+		t.Errorf("unexpected margin calls: %d", sc.MarginCalls)
+	}
+
+	sc.Margin.Maintenance = .7
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error MaxGross below Maintenance")
+	}
+}
+
+func TestMarginCall(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+
+	sc := NewStockScenario(MustParseDate("2020-01-01"), MustParseDate("2020-06-30"))
+	sc.Margin = &Margin{MaxGross: 3, Maintenance: .3, Rates: []RatePoint{{Date: MustParseDate("2000-01-01"), Rate: .02}}}
+	sc.AddStock(fxaix, 3)
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sc.MarginCalls == 0 {
+		t.Fatal("no margin calls in March 2020 at 3x leverage")
+	}
+
+	for _, sr := range sc.Results {
+		if sr.MarginCall {
+			holdings := sr.Value + sr.Loan - sr.Cash
+			if sr.Value < holdings.Mul(.3) {
+				t.Errorf("%s still below maintenance after margin call", sr.Date)
+			}
+		}
+	}
+}
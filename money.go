@@ -0,0 +1,283 @@
+package portfolio
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of dollars stored as a whole number of cents.
+type Money int64
+
+// Quantity is a number of shares stored as a whole number
+// of millionths of a share.
+type Quantity int64
+
+// Price is dollars per share stored as a whole number
+// of millionths of a dollar.
+type Price int64
+
+const (
+	centsPerDollar  = 100
+	microPerUnit    = 1000000
+	microCentsRatio = microPerUnit * microPerUnit / centsPerDollar
+)
+
+// All rounding of Money, Quantity and Price uses round half to even,
+// which eliminates bias when rounding exact halves, such as .5 cents.
+// The one exception is Price.Shares which truncates so that the shares
+// bought never cost more than the money available.
+
+// NewMoney returns the Money for an amount of dollars, rounded to the cent.
+func NewMoney(dollars float64) Money {
+	return Money(math.RoundToEven(dollars * centsPerDollar))
+}
+
+// NewQuantity returns the Quantity for a number of shares,
+// rounded to the millionth of a share.
+func NewQuantity(shares float64) Quantity {
+	return Quantity(math.RoundToEven(shares * microPerUnit))
+}
+
+// NewPrice returns the Price for an amount of dollars per share,
+// rounded to the millionth of a dollar.
+func NewPrice(dollars float64) Price {
+	return Price(math.RoundToEven(dollars * microPerUnit))
+}
+
+// ParseMoney parses a dollar amount such as "1234.56", "-$1,234.56"
+// or "(1,234.56)", rounded to the cent.
+func ParseMoney(s string) (Money, error) {
+	f, err := parseAmount(s)
+	return NewMoney(f), err
+}
+
+// ParseQuantity parses a number of shares, rounded to the millionth of a share.
+func ParseQuantity(s string) (Quantity, error) {
+	f, err := parseAmount(s)
+	return NewQuantity(f), err
+}
+
+// ParsePrice parses a price per share, rounded to the millionth of a dollar.
+func ParsePrice(s string) (Price, error) {
+	f, err := parseAmount(s)
+	return NewPrice(f), err
+}
+
+// parseAmount parses a decimal number which may contain a dollar sign,
+// thousands separators or accounting style parentheses for negatives.
+func parseAmount(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+
+	s = strings.NewReplacer("$", "", ",", "").Replace(s)
+
+	f, err := strconv.ParseFloat(s, 64)
+	if negative {
+		f = -f
+	}
+	return f, err
+}
+
+// Float returns the money as dollars.
+func (m Money) Float() float64 {
+	return float64(m) / centsPerDollar
+}
+
+// String returns the money as dollars with 2 decimal places.
+func (m Money) String() string {
+	return formatFixed(int64(m), 2, 2)
+}
+
+// MarshalJSON returns the money as a JSON number of dollars.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON parses a JSON number of dollars.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	*m = NewMoney(f)
+	return err
+}
+
+// Mul returns the money multiplied by a factor, such as a percent or rate.
+func (m Money) Mul(f float64) Money {
+	return Money(math.RoundToEven(float64(m) * f))
+}
+
+// Float returns the number of shares.
+func (q Quantity) Float() float64 {
+	return float64(q) / microPerUnit
+}
+
+// String returns the number of shares with up to 6 decimal places.
+func (q Quantity) String() string {
+	return formatFixed(int64(q), 6, 0)
+}
+
+// MarshalJSON returns the quantity as a JSON number of shares.
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalJSON parses a JSON number of shares.
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	*q = NewQuantity(f)
+	return err
+}
+
+// Value returns the value of the shares at a price, rounded to the cent.
+func (q Quantity) Value(p Price) Money {
+	return Money(mulDivRound(int64(q), int64(p), microCentsRatio))
+}
+
+// Round returns the quantity rounded to a number of decimal places from 0 to 6.
+func (q Quantity) Round(decimals int) Quantity {
+	unit := pow10(6 - decimals)
+	return Quantity(mulDivRound(int64(q), 1, unit) * unit)
+}
+
+// Float returns the price in dollars.
+func (p Price) Float() float64 {
+	return float64(p) / microPerUnit
+}
+
+// String returns the price with up to 6 decimal places.
+func (p Price) String() string {
+	return formatFixed(int64(p), 6, 2)
+}
+
+// MarshalJSON returns the price as a JSON number of dollars.
+func (p Price) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON parses a JSON number of dollars.
+func (p *Price) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	*p = NewPrice(f)
+	return err
+}
+
+// Shares returns the shares an amount of money buys at the price,
+// truncated to a number of decimal places from 0 to 6. No shares
+// are bought with no money or at a price that is not positive.
+func (p Price) Shares(m Money, decimals int) Quantity {
+	if m <= 0 || p <= 0 {
+		return 0
+	}
+
+	unit := pow10(6 - decimals)
+	hi, lo := bits.Mul64(uint64(m), microCentsRatio)
+	quo, _ := bits.Div64(hi, lo, uint64(int64(p)*unit))
+	return Quantity(int64(quo) * unit)
+}
+
+// pow10 returns 10 to the power n, for n from 0 to 18.
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
+
+// mulDivRound returns a * b / c rounded half to even, using 128 bit
+// intermediate values so the multiplication can not overflow.
+// c must be greater than 0.
+func mulDivRound(a, b, c int64) int64 {
+	negative := (a < 0) != (b < 0)
+
+	hi, lo := bits.Mul64(abs64(a), abs64(b))
+	quo, rem := bits.Div64(hi, lo, uint64(c))
+
+	// round half to even
+	half := uint64(c) - rem
+	if rem > half || (rem == half && quo%2 == 1) {
+		quo++
+	}
+
+	if negative {
+		return -int64(quo)
+	}
+	return int64(quo)
+}
+
+// abs64 returns the absolute value of n.
+func abs64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-n)
+	}
+	return uint64(n)
+}
+
+// formatFixed formats a whole number of units, where there are 10^places
+// units per 1, with at least minPlaces and at most places decimal places.
+func formatFixed(n int64, places, minPlaces int) string {
+	sign := ""
+	if n < 0 {
+		sign = "-"
+	}
+
+	unit := uint64(pow10(places))
+	whole := abs64(n) / unit
+	fraction := strconv.FormatUint(abs64(n)%unit+unit, 10)[1:]
+
+	fraction = strings.TrimRight(fraction, "0")
+	for len(fraction) < minPlaces {
+		fraction += "0"
+	}
+
+	if fraction == "" {
+		return sign + strconv.FormatUint(whole, 10)
+	}
+	return sign + strconv.FormatUint(whole, 10) + "." + fraction
+}
+
+// DecimalShares returns the ShareRounding for trading
+// in a number of decimal places of a share, from 0 to 6.
+func DecimalShares(decimals int) ShareRounding {
+	return ShareRounding(decimalSharesBase + decimals)
+}
+
+// decimalSharesBase is added to the decimal places of a DecimalShares rounding.
+const decimalSharesBase = 10
+
+// decimals returns the number of decimal places of a share
+// the rounding trades in.
+func (r ShareRounding) decimals() int {
+	switch r {
+	case WholeShares:
+		return 0
+	case UnrestrictedShares:
+		return 6
+	case MutualFundShares:
+		return 3
+	}
+
+	return int(r) - decimalSharesBase
+}
+
+// valid returns true if the rounding is one of the constants or
+// was returned by DecimalShares with 0 to 6 decimal places.
+func (r ShareRounding) valid() bool {
+	return (r >= MutualFundShares && r <= UnrestrictedShares) ||
+		(r >= decimalSharesBase && r <= decimalSharesBase+6)
+}
@@ -0,0 +1,135 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Money
+		str  string
+	}{
+		{"1234.56", 123456, "1234.56"},
+		{"$1,234.56", 123456, "1234.56"},
+		{"(1,234.56)", -123456, "-1234.56"},
+		{"-0.05", -5, "-0.05"},
+		{"0.125", 12, "0.12"},
+		{"0.135", 14, "0.14"},
+		{"10", 1000, "10.00"},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMoney(test.s)
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %v", test.s, err)
+		}
+		if m != test.want || m.String() != test.str {
+			t.Errorf("%s parsed as %d %s", test.s, m, m)
+		}
+	}
+
+	if _, err := ParseMoney("12x"); err == nil {
+		t.Error("missed error invalid money")
+	}
+
+	if NewMoney(100).Mul(.015) != 150 || Money(5).Mul(.5) != 2 || Money(7).Mul(.5) != 4 {
+		t.Error("Mul not rounding half to even")
+	}
+}
+
+func TestQuantityValue(t *testing.T) {
+	price, _ := ParsePrice("102.169998")
+	if price != 102169998 || price.String() != "102.169998" {
+		t.Errorf("invalid price %d %s", price, price)
+	}
+
+	q, _ := ParseQuantity("54.213")
+	if q != 54213000 || q.String() != "54.213" {
+		t.Errorf("invalid quantity %d %s", q, q)
+	}
+
+	// 54.213 * 102.169998 = 5538.939101574
+	if v := q.Value(price); v != 553894 {
+		t.Errorf("invalid value %s", v)
+	}
+
+	// exact halves round to even: 1 share at 0.125 and 0.135
+	if NewQuantity(1).Value(NewPrice(.125)) != 12 || NewQuantity(1).Value(NewPrice(.135)) != 14 {
+		t.Error("Value not rounding half to even")
+	}
+
+	if v := NewQuantity(-2).Value(NewPrice(1.005)); v != -201 {
+		t.Errorf("invalid negative value %s", v)
+	}
+
+	// 1,000,000 shares at 10,000 does not overflow
+	if v := NewQuantity(1000000).Value(NewPrice(10000)); v != NewMoney(10000000000) {
+		t.Errorf("invalid large value %s", v)
+	}
+}
+
+func TestPriceShares(t *testing.T) {
+	price := NewPrice(3)
+
+	// 100 / 3 = 33.3333...
+	tests := []struct {
+		decimals int
+		want     string
+	}{
+		{0, "33"},
+		{3, "33.333"},
+		{6, "33.333333"},
+	}
+
+	for _, test := range tests {
+		if q := price.Shares(NewMoney(100), test.decimals); q.String() != test.want {
+			t.Errorf("%d decimals: %s not %s", test.decimals, q, test.want)
+		}
+	}
+
+	// shares never cost more than the money available
+	if q := price.Shares(NewMoney(8.99), 0); q != NewQuantity(2) || q.Value(price) > NewMoney(8.99) {
+		t.Errorf("Shares not truncated: %s", q)
+	}
+
+	if price.Shares(NewMoney(-10), 0) != 0 {
+		t.Error("Shares not 0 for negative money")
+	}
+	if q := Price(0).Shares(NewMoney(100), 0); q != 0 {
+		t.Errorf("Shares %s at a zero price, expected 0", q)
+	}
+	if q := NewPrice(-10).Shares(NewMoney(100), 0); q != 0 {
+		t.Errorf("Shares %s at a negative price, expected 0", q)
+	}
+
+	if q := NewQuantity(1.2345).Round(3); q.String() != "1.234" {
+		t.Errorf("invalid Round %s", q)
+	}
+}
+
+func TestResultsReconcile(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+
+	sc := NewStockScenario(MustParseDate("2016-01-01"), MustParseDate("2020-12-31"))
+	sc.AddStock(fxaix, .6)
+	sc.AddStock(fxnax, .4)
+	sc.SetStockOptions("FXNAX", StockOptions{Dividends: ReinvestPayDate, PayDateLag: 2})
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// every day's value is exactly the total of the holdings
+	for _, sr := range sc.Results {
+		total := sr.Cash + sr.pendingTotal() - sr.Loan
+		for i, stock := range sc.Stocks {
+			total += sr.Shares[i].Value(stock.History[sr.StockHistIdx[i]].Close)
+		}
+
+		if total != sr.Value {
+			t.Fatalf("%s value %s not total of holdings %s", sr.Date, sr.Value, total)
+		}
+	}
+}
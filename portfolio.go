@@ -11,12 +11,24 @@ package portfolio
 // rebalanced at specific times. Currently rebalance is the 15th of the month
 // but this may change in the future.
 type StockScenario struct {
-	StartDate string
-	EndDate   string
+	Name      string
+	StartDate Date
+	EndDate   Date
 
-	StartAmt float64
-	EndAmt   float64
+	// StrictDates returns an error if the dates are outside the stock
+	// history instead of adjusting them. StartLimitedBy and EndLimitedBy
+	// are the tickers whose history limited the dates.
+	StrictDates    bool
+	StartLimitedBy string
+	EndLimitedBy   string
 
+	StartAmt Money
+	EndAmt   Money
+	CAGR     float64
+
+	// Variance and StdDev are of the daily returns about
+	// GeomeanPctChg. The Volatility method annualizes the
+	// standard deviation of the daily returns about their mean.
 	GeomeanPctChg float64
 	Variance      float64
 	StdDev        float64
@@ -25,19 +37,690 @@ type StockScenario struct {
 	PctChange  float64
 	Stocks     []*Stock
 	PctHolding []float64
+	Options    []StockOptions
+	Schedule   *AllocationSchedule
+	Strategy   Strategy
+	Margin     *Margin
 	Results    []ScenarioResults
+
+	// CashPct is the percent of the portfolio held as cash.
+	// The stock percents plus CashPct must total 1 unless
+	// NormalizeWeights is true, in which case the stock percents
+	// are scaled to total 1 less CashPct.
+	CashPct          float64
+	NormalizeWeights bool
+
+	// Income is the total of dividends and distributions
+	// paid out (not reinvested) over the scenario.
+	Income Money
+
+	// Interest is the total interest paid on margin loans
+	// and MarginCalls the number of forced rebalances.
+	Interest    Money
+	MarginCalls int
+
+	// LotMethod selects the tax lots sold first. LotSelector must be
+	// set for SpecificLots. Lots are the tax lots held for each stock
+	// at the end of the scenario and Gains the realized gains by year.
+	LotMethod   LotMethod
+	LotSelector LotSelector
+	Lots        [][]Lot
+	Gains       []RealizedGains
+
+	// Tax deducts income and capital gains taxes at the start of each
+	// year for the prior year. AfterTaxEndAmt is EndAmt less the tax
+	// for the last year, and on liquidation if Tax.Liquidate is true.
+	Tax            *TaxModel
+	TaxYears       []TaxYear
+	AfterTaxEndAmt Money
+	AfterTaxCAGR   float64
+
+	// Harvest sells stocks with losses and buys their substitute,
+	// added with AddSubstitute. HarvestBenefit is the difference in
+	// AfterTaxEndAmt from the same scenario without harvesting.
+	Harvest         *HarvestRule
+	HarvestedLosses Money
+	Harvests        int
+	HarvestBenefit  Money
+
+	// Rebalance is when the stocks are rebalanced, by default monthly.
+	Rebalance RebalancePolicy
+
+	// CashFlows are added to, or withdrawn from, the portfolio and
+	// NetCashFlow is their total. With cash flows PctChange and CAGR
+	// are time weighted, from the daily percent changes.
+	CashFlows   []CashFlow
+	NetCashFlow Money
+
+	// Costs are charged on each trade when rebalancing and
+	// TradingCosts is their total.
+	Costs        Costs
+	TradingCosts Money
+
+	// Progress, if set, is called while calculating results
+	// with the fraction of the scenario dates done, from 0 to 1.
+	Progress func(done float64)
+
+	// nextCashFlows is the number of occurrences of each
+	// cash flow applied while calculating results.
+	nextCashFlows []int
+
+	// substitutes maps the index of a stock to the index of its
+	// substitute. pairOf, held and lossSales are the harvesting
+	// state while calculating results.
+	substitutes map[int]int
+	pairOf      []int
+	held        []bool
+	lossSales   map[int]Date
+}
+
+// Portfolio is a household of accounts with an overall target percent
+// for each stock, in the same order as Stocks. The QualifiedPct in
+// Options and the Tax rates are used to estimate the tax drag of
+// holding each stock in a taxable account.
+type Portfolio struct {
+	Name       string
+	Accounts   []*Account
+	Stocks     []*Stock
+	PctHolding []float64
+	Options    []StockOptions
+	Tax        *TaxModel
+
+	// LotMethod selects the tax lots sold first from Taxable
+	// accounts. LotSelector must be set for SpecificLots.
+	LotMethod   LotMethod
+	LotSelector LotSelector
+}
+
+// AccountType determines how the income and gains of an account are taxed.
+type AccountType int
+
+const (
+	// Taxable accounts pay tax on dividends, distributions and
+	// realized gains each year. This is the default.
+	Taxable AccountType = iota
+
+	// TraditionalIRA accounts defer all tax until withdrawal.
+	TraditionalIRA
+
+	// Roth accounts are never taxed.
+	Roth
+)
+
+// Account is one account of a Portfolio, with the shares of each stock
+// held and any uninvested cash.
+type Account struct {
+	Name     string
+	Type     AccountType
+	Holdings []Holding
+	Cash     Money
+
+	// Transactions are the transactions imported for the account,
+	// in date order, and Gains the realized gains from them by year.
+	Transactions []Transaction
+	Gains        []RealizedGains
+}
+
+// Holding is the shares of a stock held in an account.
+// Lots are the tax lots of the shares in a Taxable account.
+type Holding struct {
+	Stock  *Stock
+	Shares Quantity
+	Lots   []Lot
+}
+
+// Location is the value of each stock, in the same order as
+// Portfolio.Stocks, to be held in an account.
+type Location struct {
+	Account *Account
+	Values  []Money
+}
+
+// Trade is an order to buy or sell shares of a stock in an account.
+// Amount is the estimated value of the shares at Price.
+type Trade struct {
+	Account string
+	Ticker  string
+	Action  TransactionAction
+	Shares  Quantity
+	Price   Price
+	Amount  Money
+}
+
+// TradeOptions limit the trades generated to rebalance a Portfolio.
+// Trades less than MinTrade are not made. WholeShares trades whole
+// shares of all stocks instead of in each stock's ShareRounding.
+// CashOnly only buys stocks with the cash in each account, most
+// underweight first, and NoTaxableSales does not sell in Taxable accounts.
+type TradeOptions struct {
+	MinTrade       Money
+	WholeShares    bool
+	CashOnly       bool
+	NoTaxableSales bool
+}
+
+// Transaction is a buy, sell, dividend or other cash transaction in an
+// account. Shares and Amount are not negative except for Income and
+// Transfer, where a negative Amount is removed from cash.
+type Transaction struct {
+	Date    Date
+	Account string
+	Action  TransactionAction
+	Ticker  string
+	Shares  Quantity
+	Price   Price
+	Amount  Money
+}
+
+// TransactionAction is the type of a Transaction.
+type TransactionAction int
+
+const (
+	// Ignored transactions do not change an account.
+	Ignored TransactionAction = iota
+
+	// Buy adds shares and a tax lot, paid for from cash.
+	// This includes reinvested dividends.
+	Buy
+
+	// Sell removes shares from the oldest tax lots
+	// and adds the proceeds to cash.
+	Sell
+
+	// Income adds dividends, distributions and interest to cash.
+	Income
+
+	// Transfer adds deposits to, or removes withdrawals from, cash.
+	Transfer
+)
+
+// ColumnMap names the columns of a brokerage positions or transactions
+// CSV export. Columns not in an export are left "". The header row is
+// the first row containing all of the named columns, so rows before it,
+// and rows after the last position or transaction without a symbol or
+// quantity, are skipped.
+//
+// Positions use Account, Symbol, Quantity, CostBasis, and optionally
+// Value and Acquired. Transactions use Account, Date, Action, Symbol,
+// Quantity, Price and Amount.
+//
+// Actions maps the text in the Action column, ignoring case, to an action.
+// Action text not in Actions is matched by keywords such as "BOUGHT" or
+// "DIVIDEND". CashSymbols are symbols, such as money market funds, held
+// as account cash.
+type ColumnMap struct {
+	Account   string
+	Symbol    string
+	Quantity  string
+	CostBasis string
+	Value     string
+	Acquired  string
+
+	Date   string
+	Action string
+	Price  string
+	Amount string
+
+	Actions     map[string]TransactionAction
+	CashSymbols []string
+}
+
+// Comparison compares the results of several scenarios over the dates
+// they all cover, from StartDate to EndDate. Years are the calendar years
+// in those dates and YearReturns the return of each scenario in each year.
+// Dates are all of the results dates and Values the value of each scenario
+// on each date, carried forward from its prior results date if needed.
+// Growth is the growth of 1 from StartDate to each date, from the daily
+// returns, so unlike Values it excludes cash flows.
+type Comparison struct {
+	StartDate   Date
+	EndDate     Date
+	Summaries   []ComparisonSummary
+	Years       []int
+	YearReturns [][]float64
+	Dates       []Date
+	Values      [][]Money
+	Growth      [][]float64
 }
 
-// Daily results of the portfolio value.
+// ComparisonSummary is the performance of one scenario in a Comparison.
+// Returns are time weighted, from the daily percent changes. Volatility
+// is the annualized standard deviation of the daily returns and
+// MaxDrawdown the largest decline, such as -.2, from a peak in growth.
+type ComparisonSummary struct {
+	Name         string
+	StartAmt     Money
+	EndAmt       Money
+	TotalReturn  float64
+	CAGR         float64
+	Volatility   float64
+	MaxDrawdown  float64
+	DrawdownPeak Date
+	DrawdownLow  Date
+	SharpeRatio  float64
+}
+
+// ChartKind is a kind of SVG chart of results.
+type ChartKind int
+
+const (
+	// GrowthChart is the growth of $10,000.
+	GrowthChart ChartKind = iota
+
+	// LogGrowthChart is the growth of $10,000 on a log scale.
+	LogGrowthChart
+
+	// DrawdownChart is the percent below the prior peak.
+	DrawdownChart
+
+	// AllocationChart is the percent of the portfolio in each stock
+	// and cash, stacked.
+	AllocationChart
+
+	// AnnualReturnsChart is a bar chart of the calendar year returns.
+	AnnualReturnsChart
+)
+
+// ChartOptions are the size, in pixels, and title of a chart.
+// The default size is 800 by 400 and the default title
+// is the name of the scenario and kind of chart.
+type ChartOptions struct {
+	Width  int
+	Height int
+	Title  string
+}
+
+// ReportOptions are the title of an HTML report, by default the
+// name of the scenario, and the annual risk free rate for the
+// Sharpe ratio, such as .02 for 2%.
+type ReportOptions struct {
+	Title    string
+	RiskFree float64
+}
+
+// DrawdownEpisode is a decline from a Peak to a Low, as a percent
+// such as -.2, and the Recovery to the peak. Recovered is false, and
+// Recovery not set, if the portfolio had not recovered by the end of
+// the scenario.
+type DrawdownEpisode struct {
+	Peak      Date
+	Low       Date
+	Recovery  Date
+	Recovered bool
+	Depth     float64
+}
+
+// ScenarioSummary is the summary of a scenario's results for export.
+// Holdings are the tickers and their percents.
+type ScenarioSummary struct {
+	Name           string           `json:"name"`
+	StartDate      Date             `json:"start_date"`
+	EndDate        Date             `json:"end_date"`
+	Holdings       []HoldingSummary `json:"holdings"`
+	StartAmt       Money            `json:"start_amt"`
+	EndAmt         Money            `json:"end_amt"`
+	TotalReturn    float64          `json:"total_return"`
+	CAGR           float64          `json:"cagr"`
+	Volatility     float64          `json:"volatility"`
+	Income         Money            `json:"income"`
+	NetCashFlow    Money            `json:"net_cash_flow"`
+	TradingCosts   Money            `json:"trading_costs"`
+	AfterTaxEndAmt Money            `json:"after_tax_end_amt"`
+}
+
+// HoldingSummary is a ticker and its percent of a scenario.
+type HoldingSummary struct {
+	Ticker string  `json:"ticker"`
+	Pct    float64 `json:"pct"`
+}
+
+// ResultRow is one day of a scenario's results for export.
+type ResultRow struct {
+	Date       Date            `json:"date"`
+	Holdings   []ResultHolding `json:"holdings"`
+	Cash       Money           `json:"cash"`
+	Loan       Money           `json:"loan"`
+	CashFlow   Money           `json:"cash_flow"`
+	Dividends  Money           `json:"dividends"`
+	Income     Money           `json:"income"`
+	Costs      Money           `json:"costs"`
+	Value      Money           `json:"value"`
+	PctChange  float64         `json:"pct_change"`
+	Rebalanced bool            `json:"rebalanced"`
+}
+
+// ResultHolding is the shares, closing price and value of a stock
+// on a results date.
+type ResultHolding struct {
+	Ticker string   `json:"ticker"`
+	Shares Quantity `json:"shares"`
+	Price  Price    `json:"price"`
+	Value  Money    `json:"value"`
+}
+
+// ScenarioDef is a scenario defined in a YAML or JSON scenario file.
+// Dates are "YYYY-MM-DD", weights and percents are fractions such as .6,
+// and frequencies are "monthly", "quarterly", "annually" or "never".
+// Amount defaults to 10,000 and Name to the file name.
+type ScenarioDef struct {
+	File      string        `yaml:"-" json:"-"`
+	Name      string        `yaml:"name" json:"name"`
+	From      string        `yaml:"from" json:"from"`
+	To        string        `yaml:"to" json:"to"`
+	Amount    float64       `yaml:"amount" json:"amount"`
+	CashPct   float64       `yaml:"cash_pct" json:"cash_pct"`
+	Holdings  []HoldingDef  `yaml:"holdings" json:"holdings"`
+	Rebalance RebalanceDef  `yaml:"rebalance" json:"rebalance"`
+	CashFlows []CashFlowDef `yaml:"cash_flows" json:"cash_flows"`
+	Costs     CostsDef      `yaml:"costs" json:"costs"`
+	Benchmark string        `yaml:"benchmark" json:"benchmark"`
+
+	// LoadStock, if set, returns the stock with its history for
+	// a ticker, such as from a cache, instead of NewStock.
+	LoadStock func(ticker string) (*Stock, error) `yaml:"-" json:"-"`
+
+	// lines maps the path of each value in the file,
+	// such as "holdings[0].weight", to its line number.
+	lines map[string]int
+}
+
+// HoldingDef is a stock and its weight in a scenario file.
+type HoldingDef struct {
+	Ticker string  `yaml:"ticker" json:"ticker"`
+	Weight float64 `yaml:"weight" json:"weight"`
+}
+
+// RebalanceDef is the RebalancePolicy in a scenario file.
+type RebalanceDef struct {
+	Every string  `yaml:"every" json:"every"`
+	Band  float64 `yaml:"band" json:"band"`
+}
+
+// CashFlowDef is a CashFlow in a scenario file.
+type CashFlowDef struct {
+	Date   string  `yaml:"date" json:"date"`
+	Amount float64 `yaml:"amount" json:"amount"`
+	Every  string  `yaml:"every" json:"every"`
+	Until  string  `yaml:"until" json:"until"`
+}
+
+// CostsDef is the Costs in a scenario file.
+type CostsDef struct {
+	Commission float64 `yaml:"commission" json:"commission"`
+	TradePct   float64 `yaml:"trade_pct" json:"trade_pct"`
+}
+
+// ValidationError is an error at a line of a scenario file,
+// or at line 0 if the line is not known.
+type ValidationError struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	Msg  string `json:"message"`
+}
+
+// ValidationErrors are all of the errors in a scenario file.
+type ValidationErrors []ValidationError
+
+// BatchResult is the result of running one scenario file. Benchmark is
+// nil if the scenario does not have a benchmark. Err is any error
+// reading, validating or running the scenario.
+type BatchResult struct {
+	File      string
+	Def       *ScenarioDef
+	Scenario  *StockScenario
+	Benchmark *StockScenario
+	Err       error
+}
+
+// Frequency is how often something happens during a scenario.
+type Frequency int
+
+const (
+	// Monthly is every month. This is the default.
+	Monthly Frequency = iota
+
+	// Quarterly is every January, April, July and October.
+	Quarterly
+
+	// Annually is every January.
+	Annually
+
+	// Never is never, or only once for a CashFlow.
+	Never
+)
+
+// RebalancePolicy rebalances the stocks to their target percents on the
+// first trading day after the 15th of the month Every month, quarter or
+// year. If Band is greater than 0 the stocks are also rebalanced on any
+// day a stock's percent of the portfolio differs from its target percent
+// by more than Band, such as .05 for 5 percentage points.
+type RebalancePolicy struct {
+	Every Frequency
+	Band  float64
+}
+
+// CashFlow adds Amount to the portfolio, or withdraws it if negative, on
+// the first trading day on or after Date and then Every month, quarter or
+// year through Until, if not nil. A Date late in the month recurs on the last
+// day of shorter months. Cash flows on or before the StartDate are added
+// to the initial amount. The stocks are rebalanced after a cash flow.
+type CashFlow struct {
+	Date   Date
+	Amount Money
+	Every  Frequency
+	Until  *Date
+}
+
+// Costs are the costs of trading. Each purchase or sale of a stock when
+// rebalancing costs Commission plus TradePct, such as .001 for .1%,
+// of the amount traded. Costs are paid before buying stocks.
+type Costs struct {
+	Commission Money
+	TradePct   float64
+}
+
+// HarvestRule sells the lots of a stock whose loss is at least Threshold
+// percent of their cost basis, such as .05 for 5%, and buys its substitute
+// with the proceeds. The lots of the stock which are not sold are kept.
+//
+// Wash sales are avoided by reinvesting later dividends of the stock in
+// the substitute and by not buying back a stock within 30 days after it
+// was sold at a loss. Lots bought within 30 days before a sale, including
+// from reinvested dividends, are not sold and the loss on as many of the
+// shares sold is disallowed and added to their cost basis.
+type HarvestRule struct {
+	Threshold float64
+}
+
+// TaxModel contains the tax rates for a taxable account, such as .15 for 15%.
+// Qualified dividends are taxed at QualifiedRate and all other dividends at
+// OrdinaryRate. Capital gains distributions are taxed as long term gains.
+// Net capital losses of up to MaxLossDeduction (default 3,000) a year
+// offset ordinary income and the rest is carried forward.
+type TaxModel struct {
+	QualifiedRate    float64
+	OrdinaryRate     float64
+	ShortTermRate    float64
+	LongTermRate     float64
+	MaxLossDeduction Money
+	Liquidate        bool
+}
+
+// TaxYear is the taxable income, and the tax on it, for one year.
+// LossCarryover is the net capital loss carried forward to the next year.
+type TaxYear struct {
+	Year               int
+	QualifiedDividends Money
+	OrdinaryDividends  Money
+	Distributions      Money
+	ShortTermGains     Money
+	LongTermGains      Money
+	LossCarryover      Money
+	Tax                Money
+}
+
+// Lot is a tax lot, shares of a stock bought on one date.
+// Cost is the cost basis of the shares remaining in the lot.
+type Lot struct {
+	Date   Date
+	Shares Quantity
+	Cost   Money
+}
+
+// LotMethod selects the tax lots sold first when selling shares.
+type LotMethod int
+
+const (
+	// FIFO sells the oldest lots first. This is the default.
+	FIFO LotMethod = iota
+
+	// LIFO sells the newest lots first.
+	LIFO
+
+	// HIFO sells the lots with the highest cost per share first.
+	HIFO
+
+	// SpecificLots sells lots in the order returned by the
+	// scenario's LotSelector.
+	SpecificLots
+)
+
+// LotSelector returns the indexes of lots in the order they should be
+// sold to sell shares of a stock on a date. Lots not returned are not sold.
+type LotSelector func(date Date, stock *Stock, lots []Lot, shares Quantity) []int
+
+// RealizedGains are the gains, or losses if negative, from selling
+// shares during a year. LongTerm gains are from lots held more than a year.
+type RealizedGains struct {
+	Year      int
+	ShortTerm Money
+	LongTerm  Money
+}
+
+// Margin allows the stock percents of a scenario to total more than 1,
+// up to MaxGross, by borrowing the difference. Interest is charged daily
+// at the annual rate in effect. If the equity falls below Maintenance
+// percent of the stock holdings the stocks are immediately rebalanced
+// back to their target percents.
+type Margin struct {
+	MaxGross    float64
+	Maintenance float64
+	Rates       []RatePoint
+}
+
+// RatePoint is an annual interest rate, such as .05 for 5%,
+// in effect starting on a date.
+type RatePoint struct {
+	Date Date
+	Rate float64
+}
+
+// DividendMode determines what happens to a stock's dividends
+// and capital gains distributions.
+type DividendMode int
+
+const (
+	// ReinvestExDate buys more shares at the close on the ex-date.
+	// This is the default.
+	ReinvestExDate DividendMode = iota
+
+	// ReinvestPayDate holds the dividend as a receivable and buys more
+	// shares at the close PayDateLag trading days after the ex-date.
+	ReinvestPayDate
+
+	// AccumulateCash holds the dividend as cash until the next rebalance.
+	AccumulateCash
+
+	// PayOut removes the dividend from the portfolio and
+	// tracks it as income.
+	PayOut
+)
+
+// StockOptions contains per stock settings for a scenario.
+type StockOptions struct {
+	Dividends  DividendMode
+	PayDateLag int
+	Rounding   ShareRounding
+
+	// QualifiedPct is the percent of dividends, not including
+	// distributions, which are qualified dividends for tax purposes.
+	QualifiedPct float64
+}
+
+// ShareRounding determines the fractions of a share in which a
+// stock is bought and sold, both when reinvesting dividends and
+// when rebalancing. Money left over from buying shares is held as cash.
+type ShareRounding int
+
+const (
+	// MutualFundShares trades in thousandths of a share. This is the default.
+	MutualFundShares ShareRounding = iota
+
+	// WholeShares trades whole shares only, as with ETFs at brokers
+	// which do not allow fractional shares.
+	WholeShares
+
+	// UnrestrictedShares trades in any fraction of a share
+	// down to the millionth of a share stored in a Quantity.
+	UnrestrictedShares
+)
+
+// AllocationSchedule changes the target percent for each stock
+// over the course of a scenario. Targets must be in date order.
+// Before the first target date the first target is used and after
+// the last target date the last target is used. If Linear is true
+// the percents between two target dates are interpolated by day,
+// otherwise each target is in effect until the next target date.
+type AllocationSchedule struct {
+	Targets []AllocationTarget
+	Linear  bool
+}
+
+// AllocationTarget is the percent for each stock, in the same
+// order as StockScenario.Stocks, starting on a given date.
+type AllocationTarget struct {
+	Date Date
+	Pcts []float64
+}
+
+// Strategy sets the target percent for each stock at each rebalance.
+// target contains the percents from the scenario's PctHolding or Schedule.
+// The History of each stock only contains entries up to and including
+// the rebalance date. Any percent not allocated to a stock is held as cash.
+type Strategy interface {
+	Weights(date Date, stocks []*Stock, target []float64) ([]float64, error)
+}
+
+// Daily results of the portfolio value. Dividends are the dividends
+// and distributions which went ex on the date, however they are paid.
 type ScenarioResults struct {
-	Date         string
-	Shares       []float64
+	Date         Date
+	Shares       []Quantity
 	StockHistIdx []int
-	Value        float64
-	ChangeValue  float64
+	Cash         Money
+	Loan         Money
+	Interest     Money
+	Tax          Money
+	CashFlow     Money
+	Costs        Money
+	Dividends    Money
+	MarginCall   bool
+	Rebalanced   bool
+	Pending      []PendingDividend
+	Income       Money
+	Value        Money
+	ChangeValue  Money
 	PctChange    float64
 }
 
+// PendingDividend is a dividend which has gone ex but
+// has not yet been paid.
+type PendingDividend struct {
+	StockIdx int
+	Amount   Money
+	DaysLeft int
+}
+
 // Stock information, ticker and history.
 type Stock struct {
 	Ticker  string
@@ -46,10 +729,11 @@ type Stock struct {
 
 // Stock history
 type StockHistory struct {
-	Date         string
-	Close        float64
-	Dividend     float64
-	Distribution float64
+	Date         Date
+	Close        Price
+	Dividend     Price
+	Distribution Price
 }
 
-const MaxDate = "4000-01-01"
+// pctTolerance is the allowed rounding error when totaling percents.
+const pctTolerance = .0001
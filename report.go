@@ -0,0 +1,326 @@
+package portfolio
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// reportFiles are the template and style sheet of the HTML report.
+//
+//go:embed templates/report.html templates/report.css
+var reportFiles embed.FS
+
+// reportTemplate is the parsed report template.
+var reportTemplate = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"neg": func(s string) bool { return strings.HasPrefix(s, "-") },
+}).ParseFS(reportFiles, "templates/report.html"))
+
+// reportDrawdowns is the number of drawdown episodes in a report.
+const reportDrawdowns = 5
+
+// dividendModes describes each DividendMode in a report.
+var dividendModes = map[DividendMode]string{
+	ReinvestExDate:  "reinvested on the ex-date",
+	ReinvestPayDate: "reinvested on the pay date",
+	AccumulateCash:  "held as cash until rebalancing",
+	PayOut:          "paid out",
+}
+
+// reportData is the data for the report template.
+type reportData struct {
+	Title     string
+	Style     template.CSS
+	Period    string
+	Names     []string
+	Summary   []reportRow
+	Charts    []template.HTML
+	Years     []reportRow
+	Scenarios []reportScenario
+}
+
+// reportRow is a row of a report table.
+type reportRow struct {
+	Name   string
+	Values []string
+}
+
+// reportScenario is the section of a report for one scenario.
+type reportScenario struct {
+	Name        string
+	EndDate     Date
+	Allocation  template.HTML
+	Monthly     []reportRow
+	Drawdowns   [][]string
+	Holdings    [][]string
+	Assumptions []reportRow
+}
+
+// WriteReport writes a self-contained HTML report of scenarios whose
+// results have been calculated, with their summary, charts, calendar
+// year and monthly returns, drawdowns, holdings and assumptions.
+// Several scenarios are compared over the dates they all cover.
+func WriteReport(w io.Writer, opts ReportOptions, scenarios ...*StockScenario) error {
+	c, err := CompareRiskFree(opts.RiskFree, scenarios...)
+	if err != nil {
+		return err
+	}
+
+	style, err := reportFiles.ReadFile("templates/report.css")
+	if err != nil {
+		return err
+	}
+
+	data := reportData{
+		Title:  opts.Title,
+		Style:  template.CSS(style),
+		Period: fmt.Sprintf("%s to %s", c.StartDate, c.EndDate),
+	}
+	if data.Title == "" {
+		data.Title = c.Summaries[0].Name
+		if len(scenarios) > 1 {
+			data.Title = fmt.Sprintf("Comparison of %d portfolios", len(scenarios))
+		}
+	}
+
+	for _, s := range c.Summaries {
+		data.Names = append(data.Names, s.Name)
+	}
+
+	for _, row := range summaryRows {
+		r := reportRow{Name: row.name}
+		for _, s := range c.Summaries {
+			r.Values = append(r.Values, row.value(s))
+		}
+		data.Summary = append(data.Summary, r)
+	}
+
+	for _, kind := range []ChartKind{GrowthChart, DrawdownChart, AnnualReturnsChart} {
+		svg, err := chartHTML(c.WriteChart, kind)
+		if err != nil {
+			return err
+		}
+		data.Charts = append(data.Charts, svg)
+	}
+
+	for y, year := range c.Years {
+		r := reportRow{Name: fmt.Sprint(year)}
+		for s := range c.Summaries {
+			r.Values = append(r.Values, formatPct(c.YearReturns[s][y]))
+		}
+		data.Years = append(data.Years, r)
+	}
+
+	for i, sc := range scenarios {
+		section, err := sc.reportScenario(c.Summaries[i].Name)
+		if err != nil {
+			return err
+		}
+		data.Scenarios = append(data.Scenarios, section)
+	}
+
+	return reportTemplate.Execute(w, data)
+}
+
+// DrawdownEpisodes returns the declines from a peak over the
+// scenario, from the daily returns, deepest first.
+func (sc *StockScenario) DrawdownEpisodes() []DrawdownEpisode {
+	var episodes []DrawdownEpisode
+	var episode *DrawdownEpisode
+
+	growth, peak := 1.0, 1.0
+	peakDate, low := sc.StartDate, 1.0
+	for i, sr := range sc.Results {
+		if i > 0 {
+			growth *= 1 + sr.PctChange
+		}
+
+		switch {
+		case growth >= peak:
+			if episode != nil {
+				episode.Recovery, episode.Recovered = sr.Date, true
+				episodes = append(episodes, *episode)
+				episode = nil
+			}
+			peak, peakDate = growth, sr.Date
+
+		case episode == nil || growth < low:
+			if episode == nil {
+				episode = &DrawdownEpisode{Peak: peakDate}
+			}
+			low = growth
+			episode.Low = sr.Date
+			episode.Depth = growth/peak - 1
+		}
+	}
+
+	if episode != nil {
+		episodes = append(episodes, *episode)
+	}
+
+	sort.SliceStable(episodes, func(a, b int) bool {
+		return episodes[a].Depth < episodes[b].Depth
+	})
+	return episodes
+}
+
+// reportScenario returns the report section for the scenario.
+func (sc *StockScenario) reportScenario(name string) (reportScenario, error) {
+	section := reportScenario{Name: name, EndDate: sc.EndDate}
+
+	allocation, err := chartHTML(sc.WriteChart, AllocationChart)
+	if err != nil {
+		return section, err
+	}
+	section.Allocation = allocation
+
+	section.Monthly = sc.monthlyReturns()
+
+	episodes := sc.DrawdownEpisodes()
+	if len(episodes) > reportDrawdowns {
+		episodes = episodes[:reportDrawdowns]
+	}
+	for _, e := range episodes {
+		recovery, days := "not recovered", ""
+		if e.Recovered {
+			recovery, days = e.Recovery.String(), fmt.Sprint(e.Recovery.Sub(e.Low))
+		}
+		section.Drawdowns = append(section.Drawdowns, []string{e.Peak.String(), e.Low.String(),
+			recovery, formatPct(e.Depth), fmt.Sprint(e.Low.Sub(e.Peak)), days})
+	}
+
+	last := sc.Results[len(sc.Results)-1]
+	for i, stock := range sc.Stocks {
+		close := stock.History[last.StockHistIdx[i]].Close
+		value := last.Shares[i].Value(close)
+		section.Holdings = append(section.Holdings, []string{stock.Ticker,
+			formatPct(sc.PctHolding[i]), last.Shares[i].String(), close.String(),
+			value.String(), formatPct(value.Float() / last.Value.Float())})
+	}
+	if cash := last.Cash + last.pendingTotal(); cash != 0 {
+		section.Holdings = append(section.Holdings, []string{"Cash",
+			formatPct(sc.CashPct), "", "", cash.String(), formatPct(cash.Float() / last.Value.Float())})
+	}
+	if last.Loan != 0 {
+		section.Holdings = append(section.Holdings, []string{"Loan", "", "", "",
+			(-last.Loan).String(), formatPct(-last.Loan.Float() / last.Value.Float())})
+	}
+
+	section.Assumptions = sc.assumptions()
+	return section, nil
+}
+
+// monthlyReturns returns a row for each year with the return in
+// each month and the year. Months without results are blank.
+func (sc *StockScenario) monthlyReturns() []reportRow {
+	var rows []reportRow
+	var growth [13]float64
+	var held [13]bool
+
+	addRow := func(year int) {
+		r := reportRow{Name: fmt.Sprint(year), Values: make([]string, 13)}
+		for m := range growth {
+			if held[m] {
+				r.Values[m] = formatPct(growth[m] - 1)
+			}
+		}
+		rows = append(rows, r)
+	}
+
+	for i, sr := range sc.Results {
+		if i == 0 {
+			continue
+		}
+		if prev := sc.Results[i-1].Date; held[12] && prev.Year() != sr.Date.Year() {
+			addRow(prev.Year())
+			growth, held = [13]float64{}, [13]bool{}
+		}
+
+		for _, m := range []int{int(sr.Date.Month()) - 1, 12} {
+			if !held[m] {
+				growth[m], held[m] = 1, true
+			}
+			growth[m] *= 1 + sr.PctChange
+		}
+	}
+
+	if len(sc.Results) > 1 {
+		addRow(sc.Results[len(sc.Results)-1].Date.Year())
+	}
+	return rows
+}
+
+// assumptions returns the settings of the scenario in a report.
+func (sc *StockScenario) assumptions() []reportRow {
+	var rows []reportRow
+	add := func(name, format string, args ...interface{}) {
+		rows = append(rows, reportRow{Name: name, Values: []string{fmt.Sprintf(format, args...)}})
+	}
+
+	add("Period", "%s to %s", sc.StartDate, sc.EndDate)
+	if sc.StartLimitedBy != "" {
+		add("Start limited by", "%s history", sc.StartLimitedBy)
+	}
+	if sc.EndLimitedBy != "" {
+		add("End limited by", "%s history", sc.EndLimitedBy)
+	}
+	add("Start amount", "%s", sc.StartAmt)
+	if sc.CashPct > 0 {
+		add("Cash", "%s", formatPct(sc.CashPct))
+	}
+
+	var dividends []string
+	for i, stock := range sc.Stocks {
+		dividends = append(dividends, fmt.Sprintf("%s %s", stock.Ticker, dividendModes[sc.Options[i].Dividends]))
+	}
+	add("Dividends", "%s", strings.Join(dividends, ", "))
+
+	switch {
+	case sc.Strategy != nil:
+		add("Rebalance", "%s, to the %T strategy weights", sc.Rebalance.Every, sc.Strategy)
+	case sc.Schedule != nil:
+		add("Rebalance", "%s, to the allocation schedule", sc.Rebalance.Every)
+	case sc.Rebalance.Band > 0:
+		add("Rebalance", "%s, or when a holding is %s from its target", sc.Rebalance.Every, formatPct(sc.Rebalance.Band))
+	default:
+		add("Rebalance", "%s", sc.Rebalance.Every)
+	}
+
+	for _, cf := range sc.CashFlows {
+		until := ""
+		if cf.Every != Never && cf.Until != nil {
+			until = fmt.Sprintf(" until %s", *cf.Until)
+		}
+		every := cf.Every.String()
+		if cf.Every == Never {
+			every = "once"
+		}
+		add("Cash flow", "%s %s from %s%s", cf.Amount, every, cf.Date, until)
+	}
+
+	if sc.Costs != (Costs{}) {
+		add("Costs", "%s commission and %s of each trade, %s in total",
+			sc.Costs.Commission, formatPct(sc.Costs.TradePct), sc.TradingCosts)
+	}
+	if sc.Margin != nil {
+		add("Margin", "up to %s gross, %s interest in total", formatPct(sc.Margin.MaxGross), sc.Interest)
+	}
+	if sc.Tax != nil {
+		add("Taxes", "paid each year, %s after tax", sc.AfterTaxEndAmt)
+	}
+	return rows
+}
+
+// chartHTML returns an SVG chart, written by the WriteChart method
+// of a scenario or comparison, to include in a report.
+func chartHTML(chart func(io.Writer, ChartKind, ChartOptions) error, kind ChartKind) (template.HTML, error) {
+	var b bytes.Buffer
+	if err := chart(&b, kind, ChartOptions{}); err != nil {
+		return "", fmt.Errorf("%s chart: %v", kind, err)
+	}
+	return template.HTML(b.String()), nil
+}
@@ -0,0 +1,73 @@
+package portfolio
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteReport(t *testing.T) {
+	sc := newTestScenario()
+	sc.Name = "60/40 <bonds>"
+	sc.CashFlows = []CashFlow{{Date: MustParseDate("2017-01-01"), Amount: NewMoney(1000), Every: Annually}}
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := WriteReport(&b, ReportOptions{}, sc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report := b.String()
+	for _, s := range []string{"<title>60/40 &lt;bonds&gt;</title>", "<style>", "Max drawdown",
+		"Monthly returns", "Holdings on 2020-12-31", "1000.00 annually from 2017-01-01"} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report missing %q", s)
+		}
+	}
+	if n := strings.Count(report, "<svg"); n != 4 {
+		t.Errorf("report has %d charts, expected 4", n)
+	}
+	if strings.Count(report, "http") != strings.Count(report, "http://www.w3.org/2000/svg") {
+		t.Errorf("report refers to external resources")
+	}
+
+	fxaix, _ := NewStock("FXAIX")
+	stocks := NewStockScenario(MustParseDate("2016-01-01"), MustParseDate("2020-12-31"))
+	stocks.AddStock(fxaix, 1)
+	if err := stocks.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b.Reset()
+	if err := WriteReport(&b, ReportOptions{Title: "Stocks and bonds"}, sc, stocks); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := strings.Count(b.String(), "<section>"); n != 2 {
+		t.Errorf("report has %d scenario sections, expected 2", n)
+	}
+}
+
+func TestDrawdownEpisodes(t *testing.T) {
+	sc := &StockScenario{StartDate: 1}
+	for i, pct := range []float64{0, .1, -.1, -.1, .3, .1, -.05, .02} {
+		sc.Results = append(sc.Results, ScenarioResults{Date: Date(i + 1), PctChange: pct})
+	}
+
+	episodes := sc.DrawdownEpisodes()
+	if len(episodes) != 2 {
+		t.Fatalf("%d episodes, expected 2: %+v", len(episodes), episodes)
+	}
+
+	// 1.1 to .891 and recovered by 1.1583
+	if e := episodes[0]; e.Peak != 2 || e.Low != 4 || !e.Recovered || e.Recovery != 5 || math.Abs(e.Depth+.19) > 1e-9 {
+		t.Errorf("first episode %+v", e)
+	}
+
+	// not recovered by the end
+	if e := episodes[1]; e.Peak != 6 || e.Low != 7 || e.Recovered {
+		t.Errorf("second episode %+v", e)
+	}
+}
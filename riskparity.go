@@ -0,0 +1,218 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// InverseVolatility is a Strategy which weights each stock with a target
+// percent greater than 0 in proportion to the inverse of the standard
+// deviation of its daily returns over the last Lookback (default 60)
+// trading days. The weights total to the total target percent.
+type InverseVolatility struct {
+	Lookback int
+}
+
+// RiskParity is a Strategy which weights each stock with a target percent
+// greater than 0 so each contributes equally to the portfolio variance,
+// using the covariance of daily returns over the last Lookback (default 60)
+// trading days. The weights total to the total target percent.
+type RiskParity struct {
+	Lookback int
+}
+
+// Weights returns inverse volatility weights.
+// Returns target unchanged until there is enough history.
+func (s InverseVolatility) Weights(date Date, stocks []*Stock, target []float64) ([]float64, error) {
+	lookback, err := lookbackDays(s.Lookback)
+	if err != nil {
+		return nil, err
+	}
+
+	held, returns, ok := heldReturns(stocks, target, lookback)
+	if !ok {
+		return target, nil
+	}
+
+	cov := covariance(returns)
+
+	inverse := make([]float64, len(held))
+	for i := range held {
+		if cov[i][i] == 0 {
+			return nil, errors.New("stock with 0 volatility")
+		}
+		inverse[i] = 1 / math.Sqrt(cov[i][i])
+	}
+
+	return scaleWeights(held, inverse, target), nil
+}
+
+// Weights returns equal risk contribution weights.
+// Returns target unchanged until there is enough history.
+func (s RiskParity) Weights(date Date, stocks []*Stock, target []float64) ([]float64, error) {
+	lookback, err := lookbackDays(s.Lookback)
+	if err != nil {
+		return nil, err
+	}
+
+	held, returns, ok := heldReturns(stocks, target, lookback)
+	if !ok {
+		return target, nil
+	}
+
+	cov := covariance(returns)
+	n := len(held)
+
+	// start with inverse volatility weights
+	w := make([]float64, n)
+	for i := range w {
+		if cov[i][i] == 0 {
+			return nil, errors.New("stock with 0 volatility")
+		}
+		w[i] = 1 / math.Sqrt(cov[i][i])
+	}
+	normalize(w)
+
+	// move each weight toward an equal share of the portfolio variance
+	for iter := 0; iter < 1000; iter++ {
+		contrib := make([]float64, n)
+		variance := 0.0
+		for i := range w {
+			for j := range w {
+				contrib[i] += w[i] * cov[i][j] * w[j]
+			}
+			variance += contrib[i]
+		}
+
+		maxDiff := 0.0
+		for i := range w {
+			maxDiff = math.Max(maxDiff, math.Abs(contrib[i]/variance-1/float64(n)))
+			w[i] = w[i] * math.Sqrt(variance/float64(n)/contrib[i])
+		}
+		normalize(w)
+
+		if maxDiff < 1e-8 {
+			break
+		}
+	}
+
+	return scaleWeights(held, w, target), nil
+}
+
+// lookbackDays returns the lookback, or the default 60 if 0.
+// Returns an error if it is less than the 2 days needed for a variance.
+func lookbackDays(lookback int) (int, error) {
+	if lookback == 0 {
+		return 60, nil
+	}
+	if lookback < 2 {
+		return 0, fmt.Errorf("Lookback %d less than 2", lookback)
+	}
+	return lookback, nil
+}
+
+// heldReturns returns the index of stocks with a target percent greater
+// than 0 and their daily returns over the last lookback trading days
+// on which all of those stocks have history.
+// Returns false if there are not enough days.
+func heldReturns(stocks []*Stock, target []float64, lookback int) ([]int, [][]float64, bool) {
+	var held []int
+	for i, pct := range target {
+		if pct > 0 {
+			held = append(held, i)
+		}
+	}
+
+	if len(held) == 0 {
+		return nil, nil, false
+	}
+
+	returns := make([][]float64, len(held))
+	idx := make([]int, len(held))
+	for k, i := range held {
+		idx[k] = len(stocks[i].History) - 1
+	}
+
+	// walk back through the dates all held stocks have in common
+	for len(returns[0]) < lookback {
+		date := MaxDate
+		for k, i := range held {
+			if stocks[i].History[idx[k]].Date < date {
+				date = stocks[i].History[idx[k]].Date
+			}
+		}
+
+		common := true
+		for k, i := range held {
+			for idx[k] > 0 && stocks[i].History[idx[k]].Date > date {
+				idx[k]--
+			}
+			if idx[k] < 1 {
+				return nil, nil, false
+			}
+			if stocks[i].History[idx[k]].Date != date {
+				common = false
+			}
+		}
+
+		if common {
+			for k, i := range held {
+				day := stocks[i].History[idx[k]]
+				prev := stocks[i].History[idx[k]-1]
+				r := (day.Close+day.Dividend+day.Distribution).Float()/prev.Close.Float() - 1
+				returns[k] = append(returns[k], r)
+				idx[k]--
+			}
+		}
+	}
+
+	return held, returns, true
+}
+
+// covariance returns the sample covariance matrix of
+// equal length return series.
+func covariance(returns [][]float64) [][]float64 {
+	n := len(returns)
+	days := len(returns[0])
+
+	means := make([]float64, n)
+	for i, r := range returns {
+		means[i] = sum(r) / float64(days)
+	}
+
+	cov := make([][]float64, n)
+	for i := range cov {
+		cov[i] = make([]float64, n)
+		for j := range cov[i] {
+			for d := 0; d < days; d++ {
+				cov[i][j] += (returns[i][d] - means[i]) * (returns[j][d] - means[j])
+			}
+			cov[i][j] = cov[i][j] / float64(days-1)
+		}
+	}
+
+	return cov
+}
+
+// normalize scales weights to total 1.
+func normalize(w []float64) {
+	total := sum(w)
+	for i := range w {
+		w[i] = w[i] / total
+	}
+}
+
+// scaleWeights returns weights for all stocks where the held stocks are given
+// raw weights in proportion to the total of target.
+func scaleWeights(held []int, raw []float64, target []float64) []float64 {
+	normalize(raw)
+
+	total := sum(target)
+	weights := make([]float64, len(target))
+	for k, i := range held {
+		weights[i] = raw[k] * total
+	}
+
+	return weights
+}
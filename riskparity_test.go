@@ -0,0 +1,93 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInverseVolatility(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+
+	sc := NewStockScenario(MustParseDate("2019-01-01"), MustParseDate("2019-12-31"))
+	sc.AddStock(fxaix, .6)
+	sc.AddStock(fxnax, .4)
+	sc.Strategy = InverseVolatility{}
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// bonds are less volatile so should have the larger weight
+	last := sc.Results[len(sc.Results)-1]
+	bonds := last.Shares[1].Value(fxnax.History[last.StockHistIdx[1]].Close)
+	if bonds < last.Value.Mul(.7) {
+		t.Errorf("inverse volatility bond weight %.4f", bonds.Float()/last.Value.Float())
+	}
+
+	sc.Strategy = InverseVolatility{Lookback: 1}
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error Lookback 1")
+	}
+}
+
+func TestRiskParity(t *testing.T) {
+	var stocks []*Stock
+	for _, ticker := range []string{"FXAIX", "FXNAX", "VIG"} {
+		stock, _ := NewStock(ticker)
+		// history up to 2020-06-30
+		idx := stock.getHistIdx(MustParseDate("2020-06-30"), 0) + 1
+		stocks = append(stocks, &Stock{Ticker: ticker, History: stock.History[:idx]})
+	}
+
+	target := []float64{.5, .3, .1}
+	weights, err := RiskParity{Lookback: 120}.Weights(MustParseDate("2020-06-30"), stocks, target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if math.Abs(sum(weights)-.9) > .000001 {
+		t.Errorf("weights total %.6f not .9", sum(weights))
+	}
+
+	_, returns, ok := heldReturns(stocks, target, 120)
+	if !ok {
+		t.Fatal("not enough history")
+	}
+	cov := covariance(returns)
+
+	// each stock contributes an equal share of the variance
+	contrib := make([]float64, len(weights))
+	for i := range weights {
+		for j := range weights {
+			contrib[i] += weights[i] * cov[i][j] * weights[j]
+		}
+	}
+	for i := range contrib {
+		if math.Abs(contrib[i]/sum(contrib)-1.0/3) > .0001 {
+			t.Errorf("risk contributions not equal: %v", contrib)
+			break
+		}
+	}
+
+	// stocks with no target are not held
+	weights, _ = RiskParity{}.Weights(MustParseDate("2020-06-30"), stocks, []float64{.5, .5, 0})
+	if weights[2] != 0 {
+		t.Errorf("stock with 0 target held: %v", weights)
+	}
+
+	// not enough history returns target
+	weights, _ = RiskParity{Lookback: 100000}.Weights(MustParseDate("2020-06-30"), stocks, target)
+	if weights[0] != .5 {
+		t.Errorf("target not returned without enough history: %v", weights)
+	}
+
+	for _, lookback := range []int{1, -1} {
+		if _, err := (RiskParity{Lookback: lookback}).Weights(MustParseDate("2020-06-30"), stocks, target); err == nil {
+			t.Errorf("missed error RiskParity Lookback %d", lookback)
+		}
+		if _, err := (InverseVolatility{Lookback: lookback}).Weights(MustParseDate("2020-06-30"), stocks, target); err == nil {
+			t.Errorf("missed error InverseVolatility Lookback %d", lookback)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package portfolio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultAmount is the initial amount of a scenario file without an amount.
+const defaultAmount = 10000
+
+// scenarioExts are the extensions of scenario files.
+var scenarioExts = []string{".yaml", ".yml", ".json"}
+
+// ReadScenarioFile reads and validates a YAML or JSON scenario file.
+func ReadScenarioFile(file string) (*ScenarioDef, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenario(file, data)
+}
+
+// ParseScenario parses and validates a YAML or JSON scenario.
+// file is the name used in errors. Errors are ValidationErrors.
+func ParseScenario(file string, data []byte) (*ScenarioDef, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlErrors(file, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, ValidationErrors{{File: file, Msg: "empty scenario file"}}
+	}
+
+	def := &ScenarioDef{File: file}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(def); err != nil && err != io.EOF {
+		return nil, yamlErrors(file, err)
+	}
+
+	// tickers are upper case, as in the data file names
+	for i := range def.Holdings {
+		def.Holdings[i].Ticker = strings.ToUpper(def.Holdings[i].Ticker)
+	}
+	def.Benchmark = strings.ToUpper(def.Benchmark)
+
+	def.lines = make(map[string]int)
+	recordLines(root.Content[0], "", def.lines)
+
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+// Validate verifies the values of a scenario definition.
+// Errors are ValidationErrors.
+func (def *ScenarioDef) Validate() error {
+	var errs ValidationErrors
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{File: def.File, Line: def.line(path), Msg: fmt.Sprintf(format, args...)})
+	}
+
+	from, fromErr := parseOptionalDate(def.From)
+	if fromErr != nil {
+		add("from", "from: %v", fromErr)
+	}
+	to, toErr := parseOptionalDate(def.To)
+	if toErr != nil {
+		add("to", "to: %v", toErr)
+	}
+	if fromErr == nil && toErr == nil && def.From != "" && def.To != "" && from >= to {
+		add("to", "to %s not after from %s", def.To, def.From)
+	}
+
+	if def.Amount < 0 {
+		add("amount", "amount less than 0")
+	}
+
+	if def.CashPct < 0 || def.CashPct >= 1 {
+		add("cash_pct", "cash_pct not between 0 and 1")
+	}
+
+	if len(def.Holdings) == 0 {
+		add("holdings", "no holdings")
+	}
+
+	total := 0.0
+	for i, h := range def.Holdings {
+		path := fmt.Sprintf("holdings[%d]", i)
+		if h.Ticker == "" {
+			add(path, "holding has no ticker")
+		}
+		if h.Weight <= 0 || h.Weight > 1 {
+			add(path+".weight", "weight of %s not greater than 0 and at most 1", h.Ticker)
+		}
+		total += h.Weight
+	}
+	if len(def.Holdings) > 0 && math.Abs(total+def.CashPct-1) > pctTolerance {
+		add("holdings", "weights total %.4f plus cash_pct %.4f not 1", total, def.CashPct)
+	}
+
+	if _, err := parseFrequency(def.Rebalance.Every, Monthly); err != nil {
+		add("rebalance.every", "rebalance every: %v", err)
+	}
+	if def.Rebalance.Band < 0 {
+		add("rebalance.band", "rebalance band less than 0")
+	}
+
+	for i, cf := range def.CashFlows {
+		path := fmt.Sprintf("cash_flows[%d]", i)
+		date, err := ParseDate(cf.Date)
+		if err != nil {
+			add(path+".date", "cash flow date: %v", err)
+		}
+		if cf.Amount == 0 {
+			add(path, "cash flow amount is 0")
+		}
+		if _, err := parseFrequency(cf.Every, Never); err != nil {
+			add(path+".every", "cash flow every: %v", err)
+		}
+		until, err := parseOptionalDate(cf.Until)
+		if err != nil {
+			add(path+".until", "cash flow until: %v", err)
+		} else if cf.Until != "" && until < date {
+			add(path+".until", "cash flow until before date")
+		}
+	}
+
+	if def.Costs.Commission < 0 {
+		add("costs.commission", "commission less than 0")
+	}
+	if def.Costs.TradePct < 0 || def.Costs.TradePct >= 1 {
+		add("costs.trade_pct", "trade_pct not between 0 and 1")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Scenario returns a new StockScenario for the definition
+// with the stock history read.
+func (def *ScenarioDef) Scenario() (*StockScenario, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+
+	from, to := def.dates()
+	sc := NewStockScenario(from, to)
+	sc.Name = def.Name
+	sc.CashPct = def.CashPct
+
+	for i, h := range def.Holdings {
+		stock, err := def.loadStock(h.Ticker)
+		if err != nil {
+			path := fmt.Sprintf("holdings[%d]", i)
+			return nil, ValidationErrors{{File: def.File, Line: def.line(path), Msg: fmt.Sprintf("no history for %s", h.Ticker)}}
+		}
+		if err := sc.AddStock(stock, h.Weight); err != nil {
+			return nil, err
+		}
+	}
+
+	sc.Rebalance.Every, _ = parseFrequency(def.Rebalance.Every, Monthly)
+	sc.Rebalance.Band = def.Rebalance.Band
+
+	for _, cf := range def.CashFlows {
+		flow := CashFlow{Amount: NewMoney(cf.Amount)}
+		flow.Date, _ = ParseDate(cf.Date)
+		flow.Every, _ = parseFrequency(cf.Every, Never)
+		if cf.Until != "" {
+			until, _ := ParseDate(cf.Until)
+			flow.Until = &until
+		}
+		sc.CashFlows = append(sc.CashFlows, flow)
+	}
+
+	sc.Costs = Costs{Commission: NewMoney(def.Costs.Commission), TradePct: def.Costs.TradePct}
+
+	return sc, nil
+}
+
+// loadStock returns the stock for a ticker from LoadStock, if set,
+// or else NewStock.
+func (def *ScenarioDef) loadStock(ticker string) (*Stock, error) {
+	if def.LoadStock != nil {
+		return def.LoadStock(ticker)
+	}
+	return NewStock(ticker)
+}
+
+// Run calculates the results of the scenario and of its benchmark, which
+// holds only the benchmark stock over the same dates with the same cash
+// flows. The benchmark scenario is nil if there is no benchmark.
+func (def *ScenarioDef) Run() (*StockScenario, *StockScenario, error) {
+	return def.RunContext(context.Background(), nil)
+}
+
+// RunContext is Run which stops if the context is cancelled. If progress
+// is not nil it is called with the fraction of the run done, from 0 to 1,
+// where the scenario and benchmark are each half of a run with a benchmark.
+func (def *ScenarioDef) RunContext(ctx context.Context, progress func(done float64)) (*StockScenario, *StockScenario, error) {
+	sc, err := def.Scenario()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	share := 1.0
+	if def.Benchmark != "" {
+		share = .5
+	}
+	if progress != nil {
+		sc.Progress = func(done float64) { progress(done * share) }
+	}
+
+	if err := sc.CalcResultsContext(ctx, def.amount()); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", def.File, err)
+	}
+
+	if def.Benchmark == "" {
+		return sc, nil, nil
+	}
+
+	stock, err := def.loadStock(def.Benchmark)
+	if err != nil {
+		return nil, nil, ValidationErrors{{File: def.File, Line: def.line("benchmark"),
+			Msg: fmt.Sprintf("no history for benchmark %s", def.Benchmark)}}
+	}
+
+	bench := NewStockScenario(sc.StartDate, sc.EndDate)
+	bench.Name = def.Benchmark
+	bench.AddStock(stock, 1)
+	bench.CashFlows = sc.CashFlows
+	if progress != nil {
+		bench.Progress = func(done float64) { progress(share + done*share) }
+	}
+	if err := bench.CalcResultsContext(ctx, def.amount()); err != nil {
+		return nil, nil, fmt.Errorf("%s: benchmark %w", def.File, err)
+	}
+
+	return sc, bench, nil
+}
+
+// RunScenarioDir runs every scenario file in a directory, in file name
+// order. An error in one file is returned in its BatchResult and the
+// other files are still run.
+func RunScenarioDir(dir string) ([]BatchResult, error) {
+	files, err := ScenarioFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return RunScenarioFiles(files), nil
+}
+
+// ScenarioFiles returns the YAML and JSON files in a directory in name order.
+func ScenarioFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isScenarioFile(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no scenario files in %s", dir)
+	}
+
+	return files, nil
+}
+
+// RunScenarioFiles runs each of the scenario files.
+func RunScenarioFiles(files []string) []BatchResult {
+	results := make([]BatchResult, len(files))
+	for i, file := range files {
+		results[i].File = file
+		results[i].Def, results[i].Err = ReadScenarioFile(file)
+		if results[i].Err == nil {
+			results[i].Scenario, results[i].Benchmark, results[i].Err = results[i].Def.Run()
+		}
+	}
+	return results
+}
+
+// isScenarioFile returns true if a file name has a scenario file extension.
+func isScenarioFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, scenarioExt := range scenarioExts {
+		if ext == scenarioExt {
+			return true
+		}
+	}
+	return false
+}
+
+// dates returns the from and to dates, which default to the
+// range of the stock history.
+func (def *ScenarioDef) dates() (Date, Date) {
+	from, _ := parseOptionalDate(def.From)
+	to, _ := parseOptionalDate(def.To)
+	if def.To == "" {
+		to = MaxDate
+	}
+	return from, to
+}
+
+// amount returns the initial amount.
+func (def *ScenarioDef) amount() float64 {
+	if def.Amount == 0 {
+		return defaultAmount
+	}
+	return def.Amount
+}
+
+// line returns the line of a path in the file, or of the closest
+// parent of the path, or 0 if not known.
+func (def *ScenarioDef) line(path string) int {
+	for path != "" {
+		if line, ok := def.lines[path]; ok {
+			return line
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
+
+// recordLines adds the line of each value below a node to lines.
+// The line of a mapping value is the line of its key.
+func recordLines(node *yaml.Node, path string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			lines[key] = node.Content[i].Line
+			recordLines(node.Content[i+1], key, lines)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			lines[itemPath] = item.Line
+			recordLines(item, itemPath, lines)
+		}
+	}
+}
+
+var (
+	yamlLineRE    = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlUnknownRE = regexp.MustCompile(`field (\S+) not found in type \S+`)
+)
+
+// yamlErrors converts a YAML parse or decode error to ValidationErrors.
+func yamlErrors(file string, err error) ValidationErrors {
+	msgs := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		msgs = typeErr.Errors
+	}
+
+	var errs ValidationErrors
+	for _, msg := range msgs {
+		ve := ValidationError{File: file, Msg: strings.TrimPrefix(msg, "yaml: ")}
+		if m := yamlLineRE.FindStringSubmatch(msg); m != nil {
+			ve.Line, _ = strconv.Atoi(m[1])
+			ve.Msg = m[2]
+		}
+		ve.Msg = yamlUnknownRE.ReplaceAllString(ve.Msg, "unknown field $1")
+		errs = append(errs, ve)
+	}
+	return errs
+}
+
+// parseFrequency parses a frequency name, where "" is the default.
+func parseFrequency(s string, def Frequency) (Frequency, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return def, nil
+	case "monthly":
+		return Monthly, nil
+	case "quarterly":
+		return Quarterly, nil
+	case "annually":
+		return Annually, nil
+	case "never", "once":
+		return Never, nil
+	}
+	return 0, fmt.Errorf("unknown frequency %q", s)
+}
+
+// parseOptionalDate parses a date which may be "".
+func parseOptionalDate(s string) (Date, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return ParseDate(s)
+}
+
+func (e ValidationError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,139 @@
+package portfolio
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadScenarioFile(t *testing.T) {
+	def, err := ReadScenarioFile("testdata/scenarios/sixty_forty.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sc, err := def.Scenario()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sc.StartDate != MustParseDate("2016-01-01") || len(sc.Stocks) != 2 || sc.PctHolding[1] != .4 {
+		t.Errorf("scenario not built: %s %d %v", sc.StartDate, len(sc.Stocks), sc.PctHolding)
+	}
+	if sc.Rebalance != (RebalancePolicy{Every: Quarterly, Band: .05}) || sc.Costs.TradePct != .001 {
+		t.Errorf("policy not built: %+v %+v", sc.Rebalance, sc.Costs)
+	}
+	if len(sc.CashFlows) != 1 || sc.CashFlows[0].Every != Monthly || sc.CashFlows[0].Amount != NewMoney(500) {
+		t.Errorf("cash flows not built: %+v", sc.CashFlows)
+	}
+
+	// JSON defaults the amount and rebalances monthly
+	def, err = ReadScenarioFile("testdata/scenarios/dividend.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if def.Name != "dividend growth" || def.amount() != 10000 || def.CashPct != .1 {
+		t.Errorf("JSON scenario not read: %+v", def)
+	}
+}
+
+func TestScenarioValidation(t *testing.T) {
+	tests := []struct {
+		file string
+		errs []string
+	}{
+		{"bad.yaml", []string{
+			"bad.yaml:7: cannot unmarshal !!str `abc` into float64",
+			"bad.yaml:12: unknown field fee",
+		}},
+		{"values.yaml", []string{
+			"values.yaml:2: from: ",
+			"values.yaml:3: weights total 0.9000 plus cash_pct 0.0000 not 1",
+			"values.yaml:9: rebalance every: unknown frequency \"weekly\"",
+			"values.yaml:11: cash flow amount is 0",
+		}},
+	}
+
+	for _, test := range tests {
+		_, err := ReadScenarioFile("testdata/badscenarios/" + test.file)
+		errs, ok := err.(ValidationErrors)
+		if !ok {
+			t.Fatalf("%s: error %v not ValidationErrors", test.file, err)
+		}
+
+		if len(errs) != len(test.errs) {
+			t.Errorf("%s: %d errors, expected %d:\n%v", test.file, len(errs), len(test.errs), err)
+			continue
+		}
+		for i, e := range errs {
+			if !strings.HasPrefix(e.Error(), "testdata/badscenarios/"+test.errs[i]) {
+				t.Errorf("error %q, expected %q", e.Error(), test.errs[i])
+			}
+		}
+	}
+
+	if _, err := ParseScenario("empty.yaml", nil); err == nil {
+		t.Error("missed error empty file")
+	}
+
+	def, err := ParseScenario("lower.yaml", []byte("holdings:\n  - {ticker: fxaix, weight: 1}\nbenchmark: agg\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if def.Holdings[0].Ticker != "FXAIX" || def.Benchmark != "AGG" {
+		t.Errorf("tickers %q and %q not upper case", def.Holdings[0].Ticker, def.Benchmark)
+	}
+
+	var loaded []string
+	def.LoadStock = func(ticker string) (*Stock, error) {
+		loaded = append(loaded, ticker)
+		return NewStock(ticker)
+	}
+	if _, _, err := def.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(loaded, " ") != "FXAIX AGG" {
+		t.Errorf("loaded %v, expected FXAIX and AGG", loaded)
+	}
+}
+
+func TestRunScenarioDir(t *testing.T) {
+	results, err := RunScenarioDir("testdata/scenarios")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("%d results, expected 2", len(results))
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.File, r.Err)
+		}
+	}
+
+	// sorted by file name
+	dividend, sixtyForty := results[0], results[1]
+	if dividend.Benchmark != nil || sixtyForty.Benchmark == nil {
+		t.Fatalf("benchmarks %v %v", dividend.Benchmark, sixtyForty.Benchmark)
+	}
+
+	sc, bench := sixtyForty.Scenario, sixtyForty.Benchmark
+	if bench.StartDate != sc.StartDate || bench.EndDate != sc.EndDate || bench.NetCashFlow != sc.NetCashFlow {
+		t.Errorf("benchmark %s to %s %s, scenario %s to %s %s", bench.StartDate, bench.EndDate,
+			bench.NetCashFlow, sc.StartDate, sc.EndDate, sc.NetCashFlow)
+	}
+	if sc.TradingCosts == 0 {
+		t.Error("no trading costs")
+	}
+
+	results, _ = RunScenarioDir("testdata/badscenarios")
+	for _, r := range results {
+		if r.Err == nil {
+			t.Errorf("%s: missed error", r.File)
+		}
+	}
+	if err := results[1].Err; err == nil || !strings.Contains(err.Error(), "missing.yaml:2: no history for NOSUCH") {
+		t.Errorf("missing ticker error %v", err)
+	}
+}
@@ -2,13 +2,13 @@ package portfolio
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"math"
 )
 
 func (sr *ScenarioResults) String() string {
 	var b bytes.Buffer
-	fmt.Fprintf(&b, "%s  %v  %v  %.2f  %.2f\n", sr.Date, sr.Shares, sr.StockHistIdx, sr.Value, sr.ChangeValue)
+	fmt.Fprintf(&b, "%s  %v  %v  %s  %s\n", sr.Date, sr.Shares, sr.StockHistIdx, sr.Value, sr.ChangeValue)
 	return b.String()
 }
 
@@ -18,7 +18,7 @@ func (sr *ScenarioResults) String() string {
 func (sr *ScenarioResults) initHistIdx(sc *StockScenario) {
 	sr.StockHistIdx = make([]int, len(sc.Stocks))
 
-	sr.Shares = make([]float64, len(sc.Stocks))
+	sr.Shares = make([]Quantity, len(sc.Stocks))
 
 	for i, stock := range sc.Stocks {
 		sr.StockHistIdx[i] = stock.getHistIdx(sr.Date, 0)
@@ -26,64 +26,206 @@ func (sr *ScenarioResults) initHistIdx(sc *StockScenario) {
 }
 
 // initNextResults initializes a new ScenarioResults struct.
-func (sr *ScenarioResults) initNextResults(date string, prevSR *ScenarioResults, stocks []*Stock) {
+// Dividends and distributions are handled according to
+// each stock's DividendMode.
+func (sr *ScenarioResults) initNextResults(date Date, prevSR *ScenarioResults, sc *StockScenario) {
 	sr.Date = date
+	sr.Cash = prevSR.Cash
+	sr.Loan = prevSR.Loan
 
-	sr.Shares = make([]float64, len(prevSR.Shares))
+	sr.Shares = make([]Quantity, len(prevSR.Shares))
 	copy(sr.Shares, prevSR.Shares)
 
 	sr.StockHistIdx = make([]int, len(sr.Shares))
 
-	for i, stock := range stocks {
+	for i, stock := range sc.Stocks {
 		lastIdx := prevSR.StockHistIdx[i]
-		closeIdx := stock.getCloseDateIdx(date, lastIdx)
+		closeIdx := stock.getHistIdx(date, lastIdx)
 		sr.StockHistIdx[i] = closeIdx
+	}
+
+	// pay dividends which went ex on a prior day
+	for _, pending := range prevSR.Pending {
+		pending.DaysLeft--
+		if pending.DaysLeft > 0 {
+			sr.Pending = append(sr.Pending, pending)
+			continue
+		}
+
+		i := pending.StockIdx
+		close := sc.Stocks[i].History[sr.StockHistIdx[i]].Close
+		sr.buyShares(sc, i, pending.Amount, close)
+	}
+
+	for i, stock := range sc.Stocks {
+		closeIdx := sr.StockHistIdx[i]
 
-		shares := sr.Shares[i]
 		close := stock.History[closeIdx].Close
-		dividend := stock.History[closeIdx].Dividend
-		dividend += stock.History[closeIdx].Distribution
+
+		// only new history entries contain a new dividend
+		dividend := Price(0)
+		if closeIdx != prevSR.StockHistIdx[i] {
+			dividend = stock.History[closeIdx].Dividend
+			dividend += stock.History[closeIdx].Distribution
+		}
 
 		if dividend != 0 {
-			// round to dividend amount to nearest cent
-			// use roundToEven to eliminate bias for .5 cents
-			dividendTotal := math.RoundToEven(shares * dividend * 100)
-			dividendTotal = dividendTotal / 100
+			dividendTotal := sr.Shares[i].Value(dividend)
+			sr.Dividends += dividendTotal
+			if sc.Tax != nil {
+				distribution := sr.Shares[i].Value(stock.History[closeIdx].Distribution)
+				sc.addTaxableIncome(i, sr.Date, dividendTotal-distribution, distribution)
+			}
+
+			opts := sc.Options[i]
+			switch opts.Dividends {
+			case ReinvestPayDate:
+				if opts.PayDateLag > 0 {
+					sr.Pending = append(sr.Pending,
+						PendingDividend{StockIdx: i, Amount: dividendTotal, DaysLeft: opts.PayDateLag})
+					break
+				}
+				sr.buyShares(sc, i, dividendTotal, close)
+			case AccumulateCash:
+				sr.Cash += dividendTotal
+			case PayOut:
+				sr.Income += dividendTotal
+			default:
+				sr.buyShares(sc, i, dividendTotal, close)
+			}
+		}
 
-			// calc new shares
-			newShares := dividendTotal / close
+		sr.Value += sr.Shares[i].Value(close)
+	}
 
-			// round new shares to 3 decimal points, again using roundToEven
-			newShares = math.RoundToEven(newShares * 1000)
-			newShares = newShares / 1000
+	sr.payInterest(sc, prevSR.Date)
 
-			// add new shares to holdings
-			shares += newShares
-			sr.Shares[i] = shares
-		}
+	sr.Value += sr.Cash + sr.pendingTotal() - sr.Loan
+
+	// paid out income is part of the day's return
+	sr.ChangeValue = sr.Value + sr.Income - prevSR.Value
+	sr.PctChange = float64(sr.ChangeValue) / float64(prevSR.Value)
+}
 
-		sr.Value += (close * shares)
+// payInterest charges interest on the loan for the days since the
+// prior results date, paid from cash if available or else borrowed.
+func (sr *ScenarioResults) payInterest(sc *StockScenario, prevDate Date) {
+	if sr.Loan == 0 {
+		return
 	}
 
-	sr.ChangeValue = sr.Value - prevSR.Value
-	sr.PctChange = sr.ChangeValue / prevSR.Value
+	rate := sc.Margin.rateOn(sr.Date)
+	sr.Interest = sr.Loan.Mul(rate * float64(sr.Date.Sub(prevDate)) / 365)
+
+	if sr.Cash >= sr.Interest {
+		sr.Cash -= sr.Interest
+	} else {
+		sr.Loan += sr.Interest - sr.Cash
+		sr.Cash = 0
+	}
 }
 
-// Buy/Sell stocks to rebalance the stock portfolio to the scenario defined percents.
-func (sr *ScenarioResults) rebalanceStocks(sc *StockScenario) {
+// belowMaintenance returns true if the equity is less than the
+// margin maintenance percent of the stock holdings.
+func (sr *ScenarioResults) belowMaintenance(sc *StockScenario) bool {
+	if sr.Loan == 0 {
+		return false
+	}
+
+	holdings := sr.Value + sr.Loan - sr.Cash - sr.pendingTotal()
+	return sr.Value < holdings.Mul(sc.Margin.Maintenance)
+}
+
+// pendingTotal returns the total of dividends not yet paid.
+func (sr *ScenarioResults) pendingTotal() Money {
+	total := Money(0)
+	for _, pending := range sr.Pending {
+		total += pending.Amount
+	}
+	return total
+}
+
+// buyShares buys as many shares of a stock as an amount will buy at a given
+// price, in the stock's ShareRounding. Any amount left over is added to cash.
+// If harvesting has sold the stock the substitute is bought instead.
+func (sr *ScenarioResults) buyShares(sc *StockScenario, i int, amt Money, price Price) {
+	if sc.Harvest != nil && !sc.held[i] {
+		i = sc.pairOf[i]
+		price = sc.Stocks[i].History[sr.StockHistIdx[i]].Close
+	}
+
+	shares := price.Shares(amt, sc.Options[i].Rounding.decimals())
+	if shares == 0 {
+		sr.Cash += amt
+		return
+	}
+
+	cost := shares.Value(price)
+	sc.addLot(i, Lot{Date: sr.Date, Shares: shares, Cost: cost})
+	sr.Shares[i] += shares
+	sr.Cash += amt - cost
+}
+
+// Buy/Sell stocks to rebalance the stock portfolio to the scenario defined percents
+// in effect on the results date.
+// Any accumulated cash is invested. Dividends which have not been paid
+// are not available to invest. Value not allocated to a stock is held as cash.
+// If the stock percents total more than 1 the difference is borrowed.
+func (sr *ScenarioResults) rebalanceStocks(sc *StockScenario) error {
+
+	pcts, err := sc.targetPcts(sr)
+	if err != nil {
+		return err
+	}
+	sr.Rebalanced = true
+
+	if sc.LotMethod == SpecificLots && sc.LotSelector == nil {
+		return errors.New("LotSelector not set for SpecificLots")
+	}
+
+	investable := sr.Value - sr.pendingTotal()
+	pcts = sc.harvestPcts(sr, pcts, investable)
+
+	// pay the costs of trading to the amount left after the costs
+	if costs := sr.tradeCosts(sc, pcts, investable); costs > 0 {
+		costs = sr.tradeCosts(sc, pcts, investable-costs)
+		prevValue := sr.Value + sr.Income - sr.ChangeValue
+
+		investable -= costs
+		sr.Costs = costs
+		sr.Value -= costs
+		sr.ChangeValue -= costs
+		sr.PctChange = float64(sr.ChangeValue) / float64(prevValue)
+	}
+
+	sr.Cash = investable
+	sr.Loan = 0
 
 	for i, stock := range sc.Stocks {
 		histIdx := sr.StockHistIdx[i]
 		close := stock.History[histIdx].Close
-		pct := sc.PctHolding[i]
-
-		stkValue := sr.Value * pct
-		shares := stkValue / close
-
-		// round number of shares to 3 decimal places
-		shares = math.RoundToEven(shares * 1000)
-		shares = shares / 1000
+		pct := pcts[i]
+
+		stkValue := investable.Mul(pct)
+		shares := close.Shares(stkValue, sc.Options[i].Rounding.decimals())
+
+		if shares > sr.Shares[i] {
+			bought := shares - sr.Shares[i]
+			sc.addLot(i, Lot{Date: sr.Date, Shares: bought, Cost: bought.Value(close)})
+		} else if shares < sr.Shares[i] {
+			if err := sc.sellLots(i, sr.Date, sr.Shares[i]-shares, close); err != nil {
+				return err
+			}
+		}
 
 		sr.Shares[i] = shares
+		sr.Cash -= shares.Value(close)
 	}
+
+	if sr.Cash < 0 && sc.Margin != nil {
+		sr.Loan = -sr.Cash
+		sr.Cash = 0
+	}
+
+	return nil
 }
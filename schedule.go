@@ -0,0 +1,97 @@
+package portfolio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// NewGlidePath returns a linear allocation schedule keyed by years
+// before a target date, such as a retirement date.
+// yearsToTarget[i] is the number of years before targetDate at which
+// pcts[i] is the target. For example, shifting from 90/10 to 40/60
+// over the 25 years before 2030-01-01:
+//
+//	NewGlidePath(NewDate(2030, 1, 1), []float64{25, 0},
+//		[][]float64{{.9, .1}, {.4, .6}})
+func NewGlidePath(targetDate Date, yearsToTarget []float64, pcts [][]float64) (*AllocationSchedule, error) {
+
+	if len(yearsToTarget) != len(pcts) {
+		return nil, errors.New("yearsToTarget and pcts lengths differ")
+	}
+
+	schedule := &AllocationSchedule{Linear: true}
+	for i, years := range yearsToTarget {
+		if i > 0 && years >= yearsToTarget[i-1] {
+			return nil, errors.New("yearsToTarget must be in descending order")
+		}
+
+		days := int(math.Round(years * 365.25))
+		date := targetDate.AddDays(-days)
+		schedule.Targets = append(schedule.Targets, AllocationTarget{Date: date, Pcts: pcts[i]})
+	}
+
+	return schedule, nil
+}
+
+// validate verifies the schedule has a target for each of
+// stockCount stocks and that the targets are in date order.
+func (as *AllocationSchedule) validate(stockCount int) error {
+
+	if len(as.Targets) == 0 {
+		return errors.New("allocation schedule has no targets")
+	}
+
+	for i, target := range as.Targets {
+		if i > 0 && target.Date <= as.Targets[i-1].Date {
+			return fmt.Errorf("allocation target %d date %s not after %s",
+				i, target.Date, as.Targets[i-1].Date)
+		}
+
+		if len(target.Pcts) != stockCount {
+			return fmt.Errorf("allocation target %d has %d pcts for %d stocks",
+				i, len(target.Pcts), stockCount)
+		}
+
+		for _, pct := range target.Pcts {
+			if pct < 0 {
+				return fmt.Errorf("allocation target %d pct less than 0", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// pctsOn returns the target percents in effect on a given date.
+// The schedule must already be validated.
+func (as *AllocationSchedule) pctsOn(date Date) []float64 {
+
+	first := as.Targets[0]
+	if date <= first.Date {
+		return first.Pcts
+	}
+
+	for i := 1; i < len(as.Targets); i++ {
+		next := as.Targets[i]
+		if date >= next.Date {
+			continue
+		}
+
+		prev := as.Targets[i-1]
+		if !as.Linear {
+			return prev.Pcts
+		}
+
+		// fraction of the way from prev to next
+		fraction := float64(date.Sub(prev.Date)) / float64(next.Date.Sub(prev.Date))
+
+		result := make([]float64, len(prev.Pcts))
+		for j := range result {
+			result[j] = prev.Pcts[j] + (next.Pcts[j]-prev.Pcts[j])*fraction
+		}
+		return result
+	}
+
+	return as.Targets[len(as.Targets)-1].Pcts
+}
@@ -0,0 +1,92 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewGlidePath(t *testing.T) {
+	gp, err := NewGlidePath(MustParseDate("2030-01-01"), []float64{25, 0}, [][]float64{{.9, .1}, {.4, .6}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gp.Targets[0].Date != MustParseDate("2005-01-01") || gp.Targets[1].Date != MustParseDate("2030-01-01") {
+		t.Errorf("invalid glide path dates: %s %s", gp.Targets[0].Date, gp.Targets[1].Date)
+	}
+
+	if err = gp.validate(2); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		date   Date
+		equity float64
+	}{
+		{MustParseDate("2000-01-01"), .9},
+		{MustParseDate("2005-01-01"), .9},
+		{MustParseDate("2017-07-02"), .65},
+		{MustParseDate("2030-01-01"), .4},
+		{MustParseDate("2040-01-01"), .4},
+	}
+
+	for _, test := range tests {
+		pcts := gp.pctsOn(test.date)
+		if math.Abs(pcts[0]-test.equity) > .001 || math.Abs(pcts[0]+pcts[1]-1) > .000001 {
+			t.Errorf("%s: expected %.3f equity, got %v", test.date, test.equity, pcts)
+		}
+	}
+
+	if _, err = NewGlidePath(MustParseDate("2030-01-01"), []float64{0, 25}, [][]float64{{.4, .6}, {.9, .1}}); err == nil {
+		t.Error("missed error years not descending")
+	}
+
+	if _, err = NewGlidePath(MustParseDate("2030-01-01"), []float64{25}, [][]float64{{.9, .1}, {.4, .6}}); err == nil {
+		t.Error("missed error mismatched lengths")
+	}
+
+	if err = gp.validate(3); err == nil {
+		t.Error("missed error pcts not matching stock count")
+	}
+}
+
+func TestScheduleStepped(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+
+	sc := NewStockScenario(MustParseDate("2019-01-01"), MustParseDate("2020-12-31"))
+	sc.AddStock(fxaix, .5)
+	sc.AddStock(fxnax, .5)
+	sc.Schedule = &AllocationSchedule{Targets: []AllocationTarget{
+		{Date: MustParseDate("2019-01-01"), Pcts: []float64{.8, .2}},
+		{Date: MustParseDate("2020-01-01"), Pcts: []float64{.2, .8}},
+	}}
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// first results rebalanced to 80/20
+	first := sc.Results[0]
+	equity := first.Shares[0].Value(fxaix.History[first.StockHistIdx[0]].Close).Float()
+	if math.Abs(equity/first.Value.Float()-.8) > .001 {
+		t.Errorf("first results equity %.4f not .8", equity/first.Value.Float())
+	}
+
+	// last rebalance on or after 2020-01-15 is 20/80
+	for i := len(sc.Results) - 1; i > 0; i-- {
+		sr := sc.Results[i]
+		if sr.Date.Day() >= 15 && sc.Results[i-1].Date.Day() < 15 {
+			equity = sr.Shares[0].Value(fxaix.History[sr.StockHistIdx[0]].Close).Float()
+			if math.Abs(equity/sr.Value.Float()-.2) > .001 {
+				t.Errorf("%s equity %.4f not .2", sr.Date, equity/sr.Value.Float())
+			}
+			break
+		}
+	}
+
+	sc.Schedule.Targets[1].Date = MustParseDate("2018-01-01")
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error targets out of order")
+	}
+}
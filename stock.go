@@ -2,7 +2,6 @@ package portfolio
 
 import (
 	"fmt"
-	"strconv"
 )
 
 // NewStock returns pointer to a new Stock structure
@@ -70,8 +69,12 @@ func (s *Stock) readCloseData() error {
 				return fmt.Errorf("daily close file for %s does not have 'Close' in expected column", s.Ticker)
 			}
 		} else {
-			s.History[i-1].Date = day[dateIdx]
-			s.History[i-1].Close, err = strconv.ParseFloat(day[closeIdx], 64)
+			s.History[i-1].Date, err = ParseDate(day[dateIdx])
+			if err != nil {
+				return fmt.Errorf("invalid date in stock history file for %s, line %d, %v",
+					s.Ticker, i, err)
+			}
+			s.History[i-1].Close, err = ParsePrice(day[closeIdx])
 			if err != nil {
 				return fmt.Errorf("invalid float in stock history file for %s, line %d, %v",
 					s.Ticker, i, err)
@@ -102,9 +105,14 @@ func (s *Stock) readDivData() error {
 				return fmt.Errorf("dividend file for %s does not have 'Dividends' in expected column", s.Ticker)
 			}
 		} else {
+			date, err := ParseDate(day[dateIdx])
+			if err != nil {
+				return fmt.Errorf("invalid date in stock dividends file for %s, line %d, %v",
+					s.Ticker, i, err)
+			}
 			for j, history := range s.History {
-				if history.Date >= day[dateIdx] {
-					dividend, err := strconv.ParseFloat(day[dividendsIdx], 64)
+				if history.Date >= date {
+					dividend, err := ParsePrice(day[dividendsIdx])
 					if err != nil {
 						return fmt.Errorf("invalid float in stock dividends file for %s, line %d, %v",
 							s.Ticker, i, err)
@@ -141,9 +149,14 @@ func (s *Stock) readDistrData() error {
 				return fmt.Errorf("distributions file for %s does not have 'Distributions' in expected column", s.Ticker)
 			}
 		} else {
+			date, err := ParseDate(day[dateIdx])
+			if err != nil {
+				return fmt.Errorf("invalid date in stock distributions file for %s, line %d, %v",
+					s.Ticker, i, err)
+			}
 			for j, history := range s.History {
-				if history.Date >= day[dateIdx] {
-					distribution, err := strconv.ParseFloat(day[distributionIdx], 64)
+				if history.Date >= date {
+					distribution, err := ParsePrice(day[distributionIdx])
 					if err != nil {
 						return fmt.Errorf("invalid float in stock distributions file for %s, line %d, %v",
 							s.Ticker, i, err)
@@ -160,7 +173,7 @@ func (s *Stock) readDistrData() error {
 
 // getHistIdx gets the index of the stock history entry
 // where the date is <= a given date.
-func (s *Stock) getHistIdx(date string, startIdx int) int {
+func (s *Stock) getHistIdx(date Date, startIdx int) int {
 
 	result := startIdx
 
@@ -178,7 +191,7 @@ func (s *Stock) getHistIdx(date string, startIdx int) int {
 // which is greater than lastDate.
 // Starts searching stock history at beginIdx.
 // If no next history date available, returns the constant MaxDate
-func (s *Stock) getNextDate(lastDate string, beginIdx int) string {
+func (s *Stock) getNextDate(lastDate Date, beginIdx int) Date {
 
 	for i := beginIdx; i < len(s.History); i++ {
 		if s.History[i].Date > lastDate {
@@ -188,23 +201,3 @@ func (s *Stock) getNextDate(lastDate string, beginIdx int) string {
 	return MaxDate
 }
 
-// getCloseDateIdx returns the index of the stock close date
-// which is on or before the specified date.
-// Starts search in stock history at beginIdx.
-func (s *Stock) getCloseDateIdx(closeDate string, beginIdx int) int {
-
-	result := beginIdx
-	for i := beginIdx + 1; i < len(s.History); i++ {
-		if s.History[i].Date <= closeDate {
-			result = i
-		} else {
-			return result
-		}
-	}
-
-	if result != beginIdx {
-		return result
-	}
-
-	return -1
-}
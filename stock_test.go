@@ -21,7 +21,7 @@ func TestNewStock(t *testing.T) {
 
 	for _, history := range result.History {
 		if history.Dividend != 0 {
-			if history.Date != "2003-11-03" {
+			if history.Date != MustParseDate("2003-11-03") {
 				t.Errorf("first AGG stock dividend on %s instead of 2003-11-03", history.Date)
 			}
 			break
@@ -2,27 +2,29 @@ package portfolio
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math"
-	"time"
 )
 
 // NewStockScenario creates a new instance of a Stock Scenario.
 // The new scenario will not yet contain any stock allocations.
 //
-// Note that it is important that StartDate and EndDate be set before adding
-// stock history since they will be adjusted accordingly if any of the
-// stock history start or end outside the specified date range.
-func NewStockScenario(startDate, endDate string) *StockScenario {
+// When the results are calculated StartDate and EndDate will be adjusted
+// to the range covered by the history of all of the stocks,
+// unless StrictDates is true.
+func NewStockScenario(startDate, endDate Date) *StockScenario {
 	return &StockScenario{StartDate: startDate, EndDate: endDate}
 }
 
-// AddStock adds a stock to the scenario
+// AddStock adds a stock to the scenario.
+// If the scenario will use Margin, set it before adding stocks
+// with a pct greater than 1.
 func (sc *StockScenario) AddStock(stock *Stock, pct float64) error {
 
-	if pct > 1 {
-		return errors.New("pct greater than 1")
+	if pct > sc.maxGross() {
+		return fmt.Errorf("pct greater than %g", sc.maxGross())
 	}
 
 	if pct <= 0 {
@@ -31,52 +33,146 @@ func (sc *StockScenario) AddStock(stock *Stock, pct float64) error {
 
 	sc.Stocks = append(sc.Stocks, stock)
 	sc.PctHolding = append(sc.PctHolding, pct)
+	sc.Options = append(sc.Options, StockOptions{})
 
-	if sc.StartDate < stock.History[0].Date {
-		sc.StartDate = stock.History[0].Date
+	return nil
+}
+
+// SetStockOptions sets the options for a stock which
+// has already been added to the scenario.
+func (sc *StockScenario) SetStockOptions(ticker string, opts StockOptions) error {
+
+	if opts.PayDateLag < 0 {
+		return errors.New("pay date lag less than 0")
 	}
 
-	lastHistory := len(stock.History) - 1
-	if sc.EndDate > stock.History[lastHistory].Date {
-		sc.EndDate = stock.History[lastHistory].Date
+	if !opts.Rounding.valid() {
+		return errors.New("invalid share rounding")
 	}
 
-	return nil
+	if opts.QualifiedPct < 0 || opts.QualifiedPct > 1 {
+		return errors.New("qualified pct not between 0 and 1")
+	}
+
+	for i, stock := range sc.Stocks {
+		if stock.Ticker == ticker {
+			sc.Options[i] = opts
+			return nil
+		}
+	}
+
+	return fmt.Errorf("stock %s not in scenario", ticker)
 }
 
 // CalcResults runs the defined stock scenario starting with
 // an initial amount of dollars and generates the results.
 func (sc *StockScenario) CalcResults(initialAmount float64) error {
+	return sc.CalcResultsContext(context.Background(), initialAmount)
+}
 
-	sc.StartAmt = initialAmount
+// CalcResultsContext is CalcResults which stops, returning the
+// context's error, if the context is cancelled or times out.
+// The context is checked at the start of each month.
+func (sc *StockScenario) CalcResultsContext(ctx context.Context, initialAmount float64) error {
+
+	sc.StartAmt = NewMoney(initialAmount)
+	sc.Income = 0
+	sc.Interest = 0
+	sc.MarginCalls = 0
+	sc.Lots = make([][]Lot, len(sc.Stocks))
+	sc.Gains = nil
+	sc.TaxYears = nil
+	sc.HarvestedLosses = 0
+	sc.Harvests = 0
+	sc.HarvestBenefit = 0
+	sc.NetCashFlow = 0
+	sc.nextCashFlows = make([]int, len(sc.CashFlows))
 
 	if err := sc.initResults(); err != nil {
 		return err
 	}
 
-	sc.genFirstResult(initialAmount)
+	if err := sc.genFirstResult(sc.StartAmt); err != nil {
+		return err
+	}
+	sc.TradingCosts = sc.Results[0].Costs
 
 	date := sc.getNextResultsDate()
 	for ; date <= sc.EndDate; date = sc.getNextResultsDate() {
+		if !date.SameMonth(sc.getLastResults().Date) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			sc.reportProgress(date)
+		}
+
 		sr := sc.generateDaysResults(date)
-		if sc.needRebalance() {
-			sr.rebalanceStocks(sc)
+		sc.Income += sr.Income
+		sc.Interest += sr.Interest
+		if len(sc.CashFlows) > 0 {
+			sr.applyCashFlows(sc, sc.getPrevResults().Date)
+			sc.NetCashFlow += sr.CashFlow
+			if sr.Value <= 0 {
+				return fmt.Errorf("portfolio value %s on %s after cash flows", sr.Value, sr.Date)
+			}
+		}
+		if sc.Tax != nil && sr.Date.Year() != sc.getPrevResults().Date.Year() {
+			sr.payTax(sc, sc.getPrevResults().Date.Year())
+		}
+		if sc.Harvest != nil {
+			sr.harvestLosses(sc)
+		}
+		if sr.belowMaintenance(sc) {
+			sr.MarginCall = true
+			sc.MarginCalls++
+		}
+		if sr.MarginCall || sr.CashFlow != 0 || (sr.Cash < 0 && sc.Tax != nil) ||
+			sc.needRebalance() || sr.drifted(sc) {
+			if err := sr.rebalanceStocks(sc); err != nil {
+				return err
+			}
+			sc.TradingCosts += sr.Costs
 			// sc.printScenarioResults()
 		}
 	}
 
 	lastResult := sc.getLastResults()
 	sc.EndAmt = lastResult.Value
-	sc.PctChange = sc.EndAmt/sc.StartAmt - 1
 
 	sc.calcStats()
 
+	sc.AfterTaxEndAmt = sc.EndAmt
+	sc.AfterTaxCAGR = sc.CAGR
+	if sc.Tax != nil {
+		sc.AfterTaxEndAmt -= sc.finalTax()
+		// the final tax is a loss on the last day
+		growth := (1 + sc.PctChange) * float64(sc.AfterTaxEndAmt) / float64(sc.EndAmt)
+		sc.AfterTaxCAGR = sc.cagr(growth)
+	}
+
+	if sc.Harvest != nil {
+		if err := sc.calcHarvestBenefit(ctx, initialAmount); err != nil {
+			return err
+		}
+	}
+
+	sc.reportProgress(sc.EndDate)
 	return nil
 }
 
+// reportProgress calls Progress, if set, with the fraction of
+// the scenario dates done through a date.
+func (sc *StockScenario) reportProgress(date Date) {
+	if sc.Progress != nil {
+		sc.Progress(float64(date.Sub(sc.StartDate)) / float64(sc.EndDate.Sub(sc.StartDate)))
+	}
+}
+
 // calcStats calcuates the stats for a stock scenario
 // after the results have been generated. Includes
-// geometic mean, standard deviation and sharpe ratio.
+// CAGR, geometic mean, standard deviation and sharpe ratio.
+// The percent change and CAGR are from the daily changes,
+// since the ending amount includes any cash flows.
 func (sc *StockScenario) calcStats() {
 	var chgProduct float64 = 1.0
 
@@ -88,8 +184,11 @@ func (sc *StockScenario) calcStats() {
 	}
 
 	sc.GeomeanPctChg = math.Pow(chgProduct, 1.0/float64(len(sc.Results)-1)) - 1
+	sc.PctChange = chgProduct - 1
+	sc.CAGR = sc.cagr(chgProduct)
 
 	// calculate the variance
+	sc.Variance = 0
 	for i, result := range sc.Results {
 		if i > 0 {
 			sc.Variance += math.Pow((sc.GeomeanPctChg - result.PctChange), float64(2))
@@ -100,6 +199,13 @@ func (sc *StockScenario) calcStats() {
 
 }
 
+// cagr returns the compound annual growth rate of
+// growth, such as 1.1 for 10%, over the scenario dates.
+func (sc *StockScenario) cagr(growth float64) float64 {
+	years := float64(sc.EndDate.Sub(sc.StartDate)) / 365.25
+	return math.Pow(growth, 1/years) - 1
+}
+
 func (sc *StockScenario) String() string {
 	var b bytes.Buffer
 	fmt.Fprintf(&b, "%s to %s, %d stocks, %d results\n", sc.StartDate, sc.EndDate, len(sc.Stocks), len(sc.Results))
@@ -123,51 +229,232 @@ func (sc *StockScenario) String() string {
 }
 
 // initialize the results for a stock scenario run
-//
-// TODO: go through all of the stock history again to adjust
-// start and end dates in case they are outside the range
-// of stock history? This might happen if the date range is
-// set after the stocks are added to the Stock Scenario.
-//
-// TODO: verify that percents add up to approx.  1
 func (sc *StockScenario) initResults() error {
 
-	timeFormat := "2006-01-02"
+	if err := sc.clampDates(); err != nil {
+		return err
+	}
 
-	start, err := time.Parse(timeFormat, sc.StartDate)
-	if err != nil {
+	if sc.StartDate >= sc.EndDate {
+		return fmt.Errorf("StartDate '%s' not less than EndDate '%s'", sc.StartDate, sc.EndDate)
+	}
+
+	if sc.Margin != nil {
+		if err := sc.Margin.validate(); err != nil {
+			return err
+		}
+	}
+
+	if sc.Schedule != nil {
+		if err := sc.Schedule.validate(len(sc.Stocks)); err != nil {
+			return err
+		}
+	}
+
+	if err := sc.validatePcts(); err != nil {
 		return err
 	}
 
-	end, err := time.Parse(timeFormat, sc.EndDate)
-	if err != nil {
+	if err := sc.validatePolicy(); err != nil {
 		return err
 	}
 
-	if sc.StartDate >= sc.EndDate {
-		return fmt.Errorf("StartDate '%s' not less than EndDate '%s'", sc.StartDate, sc.EndDate)
+	if err := sc.initHarvest(); err != nil {
+		return err
+	}
+
+	duration := sc.EndDate.Sub(sc.StartDate) + 1
+
+	sc.Results = make([]ScenarioResults, 0, duration)
+
+	return nil
+}
+
+// clampDates adjusts StartDate and EndDate to the range of dates
+// covered by the history of all of the stocks, and sets StartLimitedBy and
+// EndLimitedBy to the ticker which narrowed the range, if any.
+// If StrictDates is true returns an error instead of adjusting the dates.
+func (sc *StockScenario) clampDates() error {
+	sc.StartLimitedBy = ""
+	sc.EndLimitedBy = ""
+
+	for _, stock := range sc.Stocks {
+		if len(stock.History) == 0 {
+			return fmt.Errorf("stock %s has no history", stock.Ticker)
+		}
+
+		first := stock.History[0].Date
+		if sc.StartDate < first {
+			if sc.StrictDates {
+				return fmt.Errorf("StartDate '%s' before %s history starts on '%s'",
+					sc.StartDate, stock.Ticker, first)
+			}
+			sc.StartDate = first
+			sc.StartLimitedBy = stock.Ticker
+		}
+
+		last := stock.History[len(stock.History)-1].Date
+		if sc.EndDate > last {
+			if sc.StrictDates {
+				return fmt.Errorf("EndDate '%s' after %s history ends on '%s'",
+					sc.EndDate, stock.Ticker, last)
+			}
+			sc.EndDate = last
+			sc.EndLimitedBy = stock.Ticker
+		}
 	}
 
-	duration := end.Sub(start).Hours()/24 + 1
+	return nil
+}
+
+// validatePcts verifies that the stock percents plus CashPct total 1,
+// for PctHolding and each Schedule target. If NormalizeWeights is true the
+// stock percents are instead scaled so they total 1 less CashPct.
+// With Margin the stock percents may total up to Margin.MaxGross.
+func (sc *StockScenario) validatePcts() error {
+
+	if len(sc.Stocks) == 0 {
+		return errors.New("no stocks in scenario")
+	}
+
+	if sc.CashPct < 0 || sc.CashPct >= 1 {
+		return errors.New("CashPct not between 0 and 1")
+	}
+
+	if sc.NormalizeWeights && sc.Margin != nil {
+		return errors.New("NormalizeWeights can not be used with Margin")
+	}
+
+	if err := sc.checkPcts(sc.PctHolding); err != nil {
+		return fmt.Errorf("PctHolding %v", err)
+	}
 
-	sc.Results = make([]ScenarioResults, 0, int(duration))
+	if sc.Schedule != nil {
+		for i, target := range sc.Schedule.Targets {
+			if err := sc.checkPcts(target.Pcts); err != nil {
+				return fmt.Errorf("allocation target %d %v", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPcts verifies, or normalizes, one set of stock percents.
+func (sc *StockScenario) checkPcts(pcts []float64) error {
+	total := sum(pcts)
+	want := 1 - sc.CashPct
+
+	if sc.NormalizeWeights {
+		if total <= 0 {
+			return errors.New("total 0, can not normalize")
+		}
+
+		for i := range pcts {
+			pcts[i] = pcts[i] * want / total
+		}
+		return nil
+	}
+
+	if total < want-pctTolerance {
+		return fmt.Errorf("total %.4f plus CashPct %.4f less than 1", total, sc.CashPct)
+	}
+
+	if sc.Margin == nil && total > want+pctTolerance {
+		return fmt.Errorf("total %.4f plus CashPct %.4f greater than 1", total, sc.CashPct)
+	}
+
+	if total > sc.maxGross()+pctTolerance {
+		return fmt.Errorf("total %.4f greater than margin MaxGross %g", total, sc.maxGross())
+	}
 
 	return nil
 }
 
 // genFirstResult generates the first ScenarioResults entry
-func (sc *StockScenario) genFirstResult(amt float64) {
+func (sc *StockScenario) genFirstResult(amt Money) error {
 
 	results := &ScenarioResults{Date: sc.StartDate, Value: amt}
 	results.initHistIdx(sc)
-	results.rebalanceStocks(sc)
+
+	// cash flows on or before the start are added to the initial amount
+	if len(sc.CashFlows) > 0 {
+		results.applyCashFlows(sc, math.MinInt32)
+		sc.NetCashFlow += results.CashFlow
+		if results.Value <= 0 {
+			return fmt.Errorf("portfolio value %s on %s after cash flows", results.Value, results.Date)
+		}
+	}
+
+	if err := results.rebalanceStocks(sc); err != nil {
+		return err
+	}
 	sc.Results = append(sc.Results, *results)
 
+	return nil
+}
+
+// targetPcts returns the percent for each stock in effect for a results date.
+// If the scenario has a Strategy it is given the stock history
+// up to the results date only.
+func (sc *StockScenario) targetPcts(sr *ScenarioResults) ([]float64, error) {
+	pcts := sc.PctHolding
+	if sc.Schedule != nil {
+		pcts = sc.Schedule.pctsOn(sr.Date)
+	}
+
+	if sc.Strategy == nil {
+		return pcts, nil
+	}
+
+	stocks := make([]*Stock, len(sc.Stocks))
+	for i, stock := range sc.Stocks {
+		// limit capacity so history after the date can't be resliced
+		idx := sr.StockHistIdx[i] + 1
+		stocks[i] = &Stock{Ticker: stock.Ticker, History: stock.History[:idx:idx]}
+	}
+
+	target := make([]float64, len(pcts))
+	copy(target, pcts)
+
+	weights, err := sc.Strategy.Weights(sr.Date, stocks, target)
+	if err != nil {
+		return nil, fmt.Errorf("strategy on %s: %v", sr.Date, err)
+	}
+
+	if len(weights) != len(sc.Stocks) {
+		return nil, fmt.Errorf("strategy on %s returned %d weights for %d stocks",
+			sr.Date, len(weights), len(sc.Stocks))
+	}
+
+	total := 0.0
+	for _, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("strategy on %s returned weight less than 0", sr.Date)
+		}
+		total += weight
+	}
+
+	if total > sc.maxGross()+pctTolerance {
+		return nil, fmt.Errorf("strategy on %s returned weights totaling %.4f", sr.Date, total)
+	}
+
+	return weights, nil
+}
+
+// maxGross returns the maximum total of stock percents,
+// which is 1 unless the scenario uses Margin.
+func (sc *StockScenario) maxGross() float64 {
+	if sc.Margin != nil {
+		return sc.Margin.MaxGross
+	}
+
+	return 1
 }
 
 // getNextDate returns the next date for which results can be calculated.
 // If no next date, returns MaxDate.
-func (sc *StockScenario) getNextResultsDate() string {
+func (sc *StockScenario) getNextResultsDate() Date {
 	results := MaxDate
 
 	lastResults := sc.getLastResults()
@@ -186,16 +473,16 @@ func (sc *StockScenario) getNextResultsDate() string {
 }
 
 // generateDaysResults generates the results for a specified day.
-func (sc *StockScenario) generateDaysResults(date string) *ScenarioResults {
+func (sc *StockScenario) generateDaysResults(date Date) *ScenarioResults {
 	results := &ScenarioResults{}
-	results.initNextResults(date, sc.getLastResults(), sc.Stocks)
+	results.initNextResults(date, sc.getLastResults(), sc)
 	sc.Results = append(sc.Results, *results)
-	return results
+	return &sc.Results[len(sc.Results)-1]
 }
 
 // needRebalance returns true if the last days results need to be rebalanced.
-// Currently rebalances on the first trading day after the 15th.
-// "yyyy-mm-dd"
+// Rebalances on the first trading day after the 15th in the months
+// of the rebalance frequency.
 func (sc *StockScenario) needRebalance() bool {
 
 	lr := sc.getLastResults()
@@ -204,7 +491,7 @@ func (sc *StockScenario) needRebalance() bool {
 		return false
 	}
 
-	if lr.Date[8:] >= "15" {
+	if lr.Date.Day() >= 15 && sc.Rebalance.Every.includes(lr.Date) {
 
 		pr := sc.getPrevResults()
 		if pr == nil {
@@ -212,7 +499,7 @@ func (sc *StockScenario) needRebalance() bool {
 			return false
 		}
 
-		if pr.Date[8:] >= "15" {
+		if pr.Date.Day() >= 15 && pr.Date.SameMonth(lr.Date) {
 			// already rebalanced during a prior day in this month
 			return false
 		}
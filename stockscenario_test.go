@@ -1,13 +1,14 @@
 package portfolio
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"testing"
 )
 
 func TestAddStock(t *testing.T) {
-	sc := NewStockScenario("1900-01-01", "3000-01-01")
+	sc := NewStockScenario(MustParseDate("1900-01-01"), MustParseDate("3000-01-01"))
 
 	agg, err := NewStock("AGG")
 	if err != nil {
@@ -26,8 +27,8 @@ func TestAddStock(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	if sc.StartDate != "2003-09-29" || sc.EndDate != "2021-06-08" {
-		t.Errorf("start/end dates not set to stock start/end dates: %s %s", sc.StartDate, sc.EndDate)
+	if sc.StartDate != MustParseDate("1900-01-01") || sc.EndDate != MustParseDate("3000-01-01") {
+		t.Errorf("start/end dates changed before CalcResults: %s %s", sc.StartDate, sc.EndDate)
 	}
 
 	if len(sc.Stocks) != 1 || sc.Stocks[0] != agg {
@@ -46,7 +47,7 @@ func TestCalcResults(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	sc := NewStockScenario("1900-01-01", "3000-01-01")
+	sc := NewStockScenario(MustParseDate("1900-01-01"), MustParseDate("3000-01-01"))
 
 	if err = sc.AddStock(agg, 1); err != nil {
 		t.Errorf("unexpected error: %v", err)
@@ -56,27 +57,13 @@ func TestCalcResults(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	sc = NewStockScenario("202x-01-01", "2020-12-31")
-	sc.AddStock(agg, 1)
-	if err = sc.CalcResults(10000); err == nil {
-		t.Error("didn't catch invalid start date error")
-	}
-
-	// NOTE: invalid end date must still be < "2021-06-08"
-	// the highest date in AGG stock history, or it will be changed to that date.
-	sc = NewStockScenario("2020-01-01", "2020x-12-31")
-	sc.AddStock(agg, 1)
-	if err = sc.CalcResults(10000); err == nil {
-		t.Error("didn't catch invalid end date error")
-	}
-
-	sc = NewStockScenario("2021-01-01", "2020-12-31")
+	sc = NewStockScenario(MustParseDate("2021-01-01"), MustParseDate("2020-12-31"))
 	sc.AddStock(agg, 1)
 	if err = sc.CalcResults(10000); err == nil {
 		t.Error("didn't catch start date after end date error")
 	}
 
-	sc = NewStockScenario("2020-01-01", "2020-12-31")
+	sc = NewStockScenario(MustParseDate("2020-01-01"), MustParseDate("2020-12-31"))
 	sc.AddStock(agg, 1)
 	if err = sc.CalcResults(10000); err != nil {
 		t.Errorf("unexpected .Run error: %v", err)
@@ -91,9 +78,62 @@ func TestCalcResults(t *testing.T) {
 	}
 }
 
+func TestClampDates(t *testing.T) {
+	agg, _ := NewStock("AGG")
+	vdadx, _ := NewStock("VDADX")
+
+	sc := NewStockScenario(MustParseDate("1900-01-01"), MustParseDate("3000-01-01"))
+	sc.AddStock(agg, .5)
+	sc.AddStock(vdadx, .5)
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sc.StartDate != MustParseDate("2013-12-20") || sc.EndDate != MustParseDate("2021-06-08") {
+		t.Errorf("start/end dates not set to common stock dates: %s %s", sc.StartDate, sc.EndDate)
+	}
+
+	if sc.StartLimitedBy != "VDADX" || sc.EndLimitedBy != "AGG" {
+		t.Errorf("invalid limited by: %s %s", sc.StartLimitedBy, sc.EndLimitedBy)
+	}
+
+	// dates changed after the stocks were added
+	sc.StartDate = MustParseDate("2010-01-01")
+	sc.EndDate = MustParseDate("2020-12-31")
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sc.StartDate != MustParseDate("2013-12-20") || sc.EndDate != MustParseDate("2020-12-31") {
+		t.Errorf("start/end dates not reset to common stock dates: %s %s", sc.StartDate, sc.EndDate)
+	}
+
+	if sc.StartLimitedBy != "VDADX" || sc.EndLimitedBy != "" {
+		t.Errorf("invalid limited by: %s %s", sc.StartLimitedBy, sc.EndLimitedBy)
+	}
+
+	// dates on the first and last history dates are not limited
+	sc.StartDate = MustParseDate("2013-12-20")
+	sc.EndDate = MustParseDate("2021-06-08")
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sc.StartLimitedBy != "" || sc.EndLimitedBy != "" {
+		t.Errorf("limited by without narrowing the dates: %s %s", sc.StartLimitedBy, sc.EndLimitedBy)
+	}
+
+	sc.StartDate = MustParseDate("2010-01-01")
+	sc.StrictDates = true
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error start date before stock history")
+	}
+}
+
 func TestString(t *testing.T) {
 	fxaix, _ := NewStock("FXAIX")
-	sc := NewStockScenario("2020-01-01", "2021-01-01")
+	sc := NewStockScenario(MustParseDate("2020-01-01"), MustParseDate("2021-01-01"))
 	sc.AddStock(fxaix, 1)
 	sc.CalcResults(10000)
 
@@ -101,7 +141,7 @@ func TestString(t *testing.T) {
 	fmt.Println(len(sc.String()))
 
 	// output: 16902
-	if len(sc.String()) != 14062 {
+	if len(sc.String()) != 14091 {
 		t.Errorf("invalid .Results capacity: %d", cap(sc.Results))
 	}
 }
@@ -131,7 +171,7 @@ func TestCalcResults_Part02(t *testing.T) {
 
 	for i, year := range years {
 		for j, stock := range stocks {
-			sc := NewStockScenario(year+"-01-01", year+"-12-31")
+			sc := NewStockScenario(MustParseDate(year+"-01-01"), MustParseDate(year+"-12-31"))
 			sc.AddStock(stock, 1)
 			sc.CalcResults(10000)
 
@@ -151,3 +191,184 @@ func TestCalcResults_Part02(t *testing.T) {
 	}
 
 }
+
+func TestDividendModes(t *testing.T) {
+	fxnax, err := NewStock("FXNAX")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	run := func(opts StockOptions) *StockScenario {
+		sc := NewStockScenario(MustParseDate("2019-01-01"), MustParseDate("2019-12-31"))
+		sc.AddStock(fxnax, 1)
+		if err := sc.SetStockOptions("FXNAX", opts); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := sc.CalcResults(10000); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		return sc
+	}
+
+	drip := run(StockOptions{})
+	if drip.Income != 0 {
+		t.Errorf("reinvested dividends counted as income: %s", drip.Income)
+	}
+
+	payOut := run(StockOptions{Dividends: PayOut})
+	if payOut.Income <= 0 {
+		t.Error("paid out dividends not counted as income")
+	}
+	if payOut.EndAmt >= drip.EndAmt {
+		t.Errorf("paid out end amount %s not less than reinvested %s", payOut.EndAmt, drip.EndAmt)
+	}
+	if math.Abs((payOut.EndAmt + payOut.Income - drip.EndAmt).Float()) > drip.EndAmt.Float()*.01 {
+		t.Errorf("paid out total %s too far from reinvested %s", payOut.EndAmt+payOut.Income, drip.EndAmt)
+	}
+
+	cash := run(StockOptions{Dividends: AccumulateCash})
+	foundCash := false
+	for _, result := range cash.Results {
+		if result.Cash > 0 {
+			foundCash = true
+			break
+		}
+	}
+	if !foundCash {
+		t.Error("dividends not accumulated to cash")
+	}
+
+	payDate := run(StockOptions{Dividends: ReinvestPayDate, PayDateLag: 2})
+	foundPending := false
+	for _, result := range payDate.Results {
+		if len(result.Pending) > 0 {
+			foundPending = true
+			break
+		}
+	}
+	if !foundPending {
+		t.Error("pay date dividends not held as pending")
+	}
+	if math.Abs((payDate.EndAmt - drip.EndAmt).Float()) > drip.EndAmt.Float()*.01 {
+		t.Errorf("pay date end amount %s too far from ex-date %s", payDate.EndAmt, drip.EndAmt)
+	}
+
+	sc := NewStockScenario(MustParseDate("2019-01-01"), MustParseDate("2019-12-31"))
+	sc.AddStock(fxnax, 1)
+	if err := sc.SetStockOptions("AGG", StockOptions{}); err == nil {
+		t.Error("missed error for stock not in scenario")
+	}
+	if err := sc.SetStockOptions("FXNAX", StockOptions{PayDateLag: -1}); err == nil {
+		t.Error("missed error for negative pay date lag")
+	}
+}
+
+func TestValidatePcts(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+
+	sc := NewStockScenario(MustParseDate("2019-01-01"), MustParseDate("2019-12-31"))
+	sc.AddStock(fxaix, .5)
+	sc.AddStock(fxnax, .2)
+
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error pcts total less than 1")
+	}
+
+	// residual held as cash
+	sc.CashPct = .3
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(sc.Results[0].Cash.Float()-3000) > 1 {
+		t.Errorf("cash %s not 3000", sc.Results[0].Cash)
+	}
+
+	sc.CashPct = .5
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error pcts plus cash total greater than 1")
+	}
+
+	sc.NormalizeWeights = true
+	sc.CashPct = .3
+	sc.PctHolding = []float64{.5, .5}
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sc.PctHolding[0] != .35 || sc.PctHolding[1] != .35 {
+		t.Errorf("pcts not normalized: %v", sc.PctHolding)
+	}
+
+	sc = NewStockScenario(MustParseDate("2019-01-01"), MustParseDate("2019-12-31"))
+	if err := sc.CalcResults(10000); err == nil {
+		t.Error("missed error no stocks")
+	}
+}
+
+func TestShareRounding(t *testing.T) {
+	vig, _ := NewStock("VIG")
+	fxnax, _ := NewStock("FXNAX")
+
+	sc := NewStockScenario(MustParseDate("2019-01-01"), MustParseDate("2019-12-31"))
+	sc.AddStock(vig, .6)
+	sc.AddStock(fxnax, .4)
+	sc.SetStockOptions("VIG", StockOptions{Rounding: WholeShares})
+	sc.SetStockOptions("FXNAX", StockOptions{Rounding: DecimalShares(1)})
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, sr := range sc.Results {
+		if sr.Shares[0] != sr.Shares[0].Round(0) || sr.Shares[1] != sr.Shares[1].Round(1) {
+			t.Fatalf("%s shares not rounded: %v", sr.Date, sr.Shares)
+		}
+		if sr.Cash < 0 {
+			t.Fatalf("%s cash less than 0: %s", sr.Date, sr.Cash)
+		}
+	}
+
+	// whole shares of a stock over $100 leaves cash
+	if sc.Results[0].Cash == 0 {
+		t.Error("no cash left over from whole shares")
+	}
+
+	if err := sc.SetStockOptions("VIG", StockOptions{Rounding: DecimalShares(7)}); err == nil {
+		t.Error("missed error invalid share rounding")
+	}
+}
+
+func TestCalcResultsContext(t *testing.T) {
+	sc := newTestScenario()
+
+	var progress []float64
+	sc.Progress = func(done float64) {
+		progress = append(progress, done)
+	}
+	if err := sc.CalcResultsContext(context.Background(), 10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the start of each of 60 months, after the first, and the end
+	if len(progress) != 60 || progress[len(progress)-1] != 1 {
+		t.Fatalf("progress %v, expected 60 values ending with 1", progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Fatalf("progress %v not increasing", progress)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sc.Progress = func(done float64) {
+		if done > .5 {
+			cancel()
+		}
+	}
+	if err := sc.CalcResultsContext(ctx, 10000); err != context.Canceled {
+		t.Fatalf("error %v, expected %v", err, context.Canceled)
+	}
+	if last := sc.Results[len(sc.Results)-1].Date; last.Year() != 2018 {
+		t.Errorf("cancelled after %s, expected in 2018", last)
+	}
+}
@@ -0,0 +1,225 @@
+package portfolio
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MovingAverageTiming is a Strategy which holds a stock only while its close
+// is above the average of its prior month end closes. The target percent
+// of a stock below its average is moved to the Safe stock, or to cash if
+// Safe is "". The Safe stock itself is always held.
+//
+// With the default of 10 months this is the 10 month moving average
+// timing rule.
+type MovingAverageTiming struct {
+	Months int
+	Safe   string
+}
+
+// DualMomentum is a Strategy which puts the total target percent into the
+// stock with the highest trailing return over Months (default 12) as long
+// as that return is greater than the return of the Safe stock, or greater
+// than 0 if Safe is "". Otherwise the total is put into the Safe stock,
+// or cash.
+type DualMomentum struct {
+	Months int
+	Safe   string
+}
+
+// RelativeStrength is a Strategy which splits the total target percent
+// equally among the Top (default 1) stocks with the highest trailing
+// return over Months (default 6).
+type RelativeStrength struct {
+	Months int
+	Top    int
+}
+
+// Weights returns the target weights for the moving average timing rule.
+// Returns target unchanged until there are enough month end closes.
+func (s MovingAverageTiming) Weights(date Date, stocks []*Stock, target []float64) ([]float64, error) {
+	months := s.Months
+	if months == 0 {
+		months = 10
+	}
+
+	safeIdx, err := findTicker(stocks, s.Safe)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := make([]float64, len(target))
+	copy(weights, target)
+
+	for i, stock := range stocks {
+		if i == safeIdx {
+			continue
+		}
+
+		closes := monthEndCloses(stock, months)
+		if len(closes) < months {
+			return target, nil
+		}
+
+		average := 0.0
+		for _, close := range closes {
+			average += close
+		}
+		average = average / float64(months)
+
+		if stock.History[len(stock.History)-1].Close.Float() < average {
+			if safeIdx >= 0 {
+				weights[safeIdx] += weights[i]
+			}
+			weights[i] = 0
+		}
+	}
+
+	return weights, nil
+}
+
+// Weights returns the target weights for dual momentum.
+// Returns target unchanged until there is enough history.
+func (s DualMomentum) Weights(date Date, stocks []*Stock, target []float64) ([]float64, error) {
+	months := s.Months
+	if months == 0 {
+		months = 12
+	}
+
+	safeIdx, err := findTicker(stocks, s.Safe)
+	if err != nil {
+		return nil, err
+	}
+
+	returns, ok := trailingReturns(stocks, date, months)
+	if !ok {
+		return target, nil
+	}
+
+	best := -1
+	for i := range stocks {
+		if i != safeIdx && (best < 0 || returns[i] > returns[best]) {
+			best = i
+		}
+	}
+
+	hurdle := 0.0
+	if safeIdx >= 0 {
+		hurdle = returns[safeIdx]
+	}
+
+	weights := make([]float64, len(target))
+	if best >= 0 && returns[best] > hurdle {
+		weights[best] = sum(target)
+	} else if safeIdx >= 0 {
+		weights[safeIdx] = sum(target)
+	}
+
+	return weights, nil
+}
+
+// Weights returns the target weights for relative strength rotation.
+// Returns target unchanged until there is enough history.
+func (s RelativeStrength) Weights(date Date, stocks []*Stock, target []float64) ([]float64, error) {
+	months := s.Months
+	if months == 0 {
+		months = 6
+	}
+
+	top := s.Top
+	if top == 0 {
+		top = 1
+	}
+
+	if top < 0 || top > len(stocks) {
+		return nil, fmt.Errorf("relative strength top %d not between 1 and %d", top, len(stocks))
+	}
+
+	returns, ok := trailingReturns(stocks, date, months)
+	if !ok {
+		return target, nil
+	}
+
+	ranked := make([]int, len(stocks))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return returns[ranked[a]] > returns[ranked[b]]
+	})
+
+	weights := make([]float64, len(target))
+	for _, i := range ranked[:top] {
+		weights[i] = sum(target) / float64(top)
+	}
+
+	return weights, nil
+}
+
+// findTicker returns the index of a ticker in stocks,
+// or -1 if the ticker is "".
+func findTicker(stocks []*Stock, ticker string) (int, error) {
+	if ticker == "" {
+		return -1, nil
+	}
+
+	for i, stock := range stocks {
+		if stock.Ticker == ticker {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("stock %s not in scenario", ticker)
+}
+
+// monthEndCloses returns up to months closes from the last history
+// entry of each month prior to the month of the last history entry.
+// Closes are in reverse date order.
+func monthEndCloses(stock *Stock, months int) []float64 {
+	var closes []float64
+
+	month := stock.History[len(stock.History)-1].Date
+	for i := len(stock.History) - 1; i >= 0 && len(closes) < months; i-- {
+		if !stock.History[i].Date.SameMonth(month) {
+			month = stock.History[i].Date
+			closes = append(closes, stock.History[i].Close.Float())
+		}
+	}
+
+	return closes
+}
+
+// trailingReturns returns the total return of each stock over the
+// months prior to date, with dividends and distributions added
+// to the ending close. Returns false if any of the stocks do not
+// have history that far back.
+func trailingReturns(stocks []*Stock, date Date, months int) ([]float64, bool) {
+	from := date.AddDate(0, -months, 0)
+
+	returns := make([]float64, len(stocks))
+	for i, stock := range stocks {
+		if stock.History[0].Date > from {
+			return nil, false
+		}
+
+		fromIdx := stock.getHistIdx(from, 0)
+
+		end := stock.History[len(stock.History)-1].Close
+		for _, history := range stock.History[fromIdx+1:] {
+			end += history.Dividend + history.Distribution
+		}
+
+		returns[i] = end.Float()/stock.History[fromIdx].Close.Float() - 1
+	}
+
+	return returns, true
+}
+
+// sum returns the total of a slice of percents.
+func sum(pcts []float64) float64 {
+	total := 0.0
+	for _, pct := range pcts {
+		total += pct
+	}
+	return total
+}
@@ -0,0 +1,114 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+// lookAheadCheck is a Strategy which records any
+// history passed to it after the rebalance date.
+type lookAheadCheck struct {
+	t     *testing.T
+	calls int
+}
+
+func (s *lookAheadCheck) Weights(date Date, stocks []*Stock, target []float64) ([]float64, error) {
+	s.calls++
+	for _, stock := range stocks {
+		last := stock.History[len(stock.History)-1]
+		if last.Date > date || cap(stock.History) != len(stock.History) {
+			s.t.Errorf("%s history available after %s", stock.Ticker, date)
+		}
+	}
+	return target, nil
+}
+
+func newStrategyScenario(t *testing.T, start, end Date, strategy Strategy) *StockScenario {
+	sc := NewStockScenario(start, end)
+	for _, ticker := range []string{"FXAIX", "FXNAX", "VIG"} {
+		stock, err := NewStock(ticker)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sc.AddStock(stock, 1.0/3)
+	}
+	sc.Strategy = strategy
+
+	if err := sc.CalcResults(10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return sc
+}
+
+// heldCount returns the number of stocks with shares in results.
+func heldCount(sr ScenarioResults) int {
+	count := 0
+	for _, shares := range sr.Shares {
+		if shares > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func TestStrategyLookAhead(t *testing.T) {
+	check := &lookAheadCheck{t: t}
+	newStrategyScenario(t, MustParseDate("2019-01-01"), MustParseDate("2019-12-31"), check)
+
+	// first day plus 12 months
+	if check.calls != 13 {
+		t.Errorf("strategy called %d times", check.calls)
+	}
+}
+
+func TestMovingAverageTiming(t *testing.T) {
+	sc := newStrategyScenario(t, MustParseDate("2020-01-01"), MustParseDate("2020-06-30"), MovingAverageTiming{Safe: "FXNAX"})
+
+	// 2020-04-15 after the March crash equities are below their average
+	found := false
+	for _, sr := range sc.Results {
+		if sr.Date == MustParseDate("2020-04-15") {
+			found = true
+			if sr.Shares[0] != 0 || sr.Shares[2] != 0 {
+				t.Errorf("equities held below moving average: %v", sr.Shares)
+			}
+			fxnax := sc.Stocks[1]
+			if sr.Shares[1].Value(fxnax.History[sr.StockHistIdx[1]].Close) < sr.Value.Mul(.99) {
+				t.Errorf("safe stock not holding value: %v", sr.Shares)
+			}
+		}
+	}
+	if !found {
+		t.Error("no results for 2020-04-15")
+	}
+
+	if _, err := (MovingAverageTiming{Safe: "XXX"}).Weights(MustParseDate("2020-01-01"), sc.Stocks, sc.PctHolding); err == nil {
+		t.Error("missed error safe stock not in scenario")
+	}
+}
+
+func TestDualMomentum(t *testing.T) {
+	sc := newStrategyScenario(t, MustParseDate("2019-01-01"), MustParseDate("2020-12-31"), DualMomentum{Safe: "FXNAX"})
+
+	for i, sr := range sc.Results {
+		if i > 0 && heldCount(sr) != 1 {
+			t.Errorf("%s holding %d stocks", sr.Date, heldCount(sr))
+			break
+		}
+	}
+}
+
+func TestRelativeStrength(t *testing.T) {
+	sc := newStrategyScenario(t, MustParseDate("2019-01-01"), MustParseDate("2020-12-31"), RelativeStrength{Top: 2})
+
+	for i, sr := range sc.Results {
+		if i > 0 && heldCount(sr) != 2 {
+			t.Errorf("%s holding %d stocks", sr.Date, heldCount(sr))
+			break
+		}
+	}
+
+	if _, err := (RelativeStrength{Top: 4}).Weights(MustParseDate("2020-01-01"), sc.Stocks, sc.PctHolding); err == nil {
+		t.Error("missed error top greater than number of stocks")
+	}
+}
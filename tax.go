@@ -0,0 +1,154 @@
+package portfolio
+
+// defaultMaxLossDeduction is the net capital loss which
+// can offset ordinary income each year.
+var defaultMaxLossDeduction = NewMoney(3000)
+
+// addTaxableIncome adds dividends and distributions
+// from stock i to the tax year of a date.
+func (sc *StockScenario) addTaxableIncome(i int, date Date, dividends, distributions Money) {
+	ty := sc.taxYear(date.Year())
+
+	qualified := dividends.Mul(sc.Options[i].QualifiedPct)
+	ty.QualifiedDividends += qualified
+	ty.OrdinaryDividends += dividends - qualified
+	ty.Distributions += distributions
+}
+
+// taxYear returns the TaxYear for a year, adding it in year order if needed.
+func (sc *StockScenario) taxYear(year int) *TaxYear {
+	i := 0
+	for ; i < len(sc.TaxYears) && sc.TaxYears[i].Year <= year; i++ {
+		if sc.TaxYears[i].Year == year {
+			return &sc.TaxYears[i]
+		}
+	}
+
+	sc.TaxYears = append(sc.TaxYears, TaxYear{})
+	copy(sc.TaxYears[i+1:], sc.TaxYears[i:])
+	sc.TaxYears[i] = TaxYear{Year: year}
+	return &sc.TaxYears[i]
+}
+
+// carryoverTo returns the net capital loss carried over to a year.
+func (sc *StockScenario) carryoverTo(year int) Money {
+	for _, ty := range sc.TaxYears {
+		if ty.Year == year-1 {
+			return ty.LossCarryover
+		}
+	}
+	return 0
+}
+
+// gainsFor returns the realized gains for a year.
+func (sc *StockScenario) gainsFor(year int) RealizedGains {
+	for _, g := range sc.Gains {
+		if g.Year == year {
+			return g
+		}
+	}
+	return RealizedGains{Year: year}
+}
+
+// payTax calculates the tax for a year and deducts it from cash.
+// If this leaves cash below 0 the stocks need to be rebalanced.
+func (sr *ScenarioResults) payTax(sc *StockScenario, year int) {
+	ty := sc.taxYear(year)
+	gains := sc.gainsFor(year)
+	ty.ShortTermGains = gains.ShortTerm
+	ty.LongTermGains = gains.LongTerm
+
+	ty.Tax, ty.LossCarryover = sc.Tax.calcTax(*ty, sc.carryoverTo(year))
+
+	prevValue := sr.Value + sr.Income - sr.ChangeValue
+
+	sr.Tax = ty.Tax
+	sr.Cash -= ty.Tax
+	sr.Value -= ty.Tax
+	sr.ChangeValue -= ty.Tax
+	sr.PctChange = float64(sr.ChangeValue) / float64(prevValue)
+}
+
+// finalTax returns the tax for the last year of the scenario, which has
+// not been paid, plus the tax from selling all lots if Tax.Liquidate is true.
+func (sc *StockScenario) finalTax() Money {
+	last := sc.getLastResults()
+	year := last.Date.Year()
+
+	final := sc.taxYear(year)
+	gains := sc.gainsFor(year)
+	final.ShortTermGains = gains.ShortTerm
+	final.LongTermGains = gains.LongTerm
+	final.Tax, final.LossCarryover = sc.Tax.calcTax(*final, sc.carryoverTo(year))
+
+	if !sc.Tax.Liquidate {
+		return final.Tax
+	}
+
+	// add the gains from selling all of the lots
+	ty := *final
+	for i, stock := range sc.Stocks {
+		close := stock.History[last.StockHistIdx[i]].Close
+		for _, lot := range sc.Lots[i] {
+			gain := lot.Shares.Value(close) - lot.Cost
+			if longTerm(lot.Date, last.Date) {
+				ty.LongTermGains += gain
+			} else {
+				ty.ShortTermGains += gain
+			}
+		}
+	}
+
+	tax, _ := sc.Tax.calcTax(ty, sc.carryoverTo(year))
+	return tax
+}
+
+// calcTax returns the tax for a year and the net capital loss to carry
+// over to the next year, given the loss carried over from the prior year.
+// Short and long term gains are netted against each other and a
+// net loss offsets ordinary income up to MaxLossDeduction.
+func (tm *TaxModel) calcTax(ty TaxYear, carryover Money) (Money, Money) {
+	st := ty.ShortTermGains - carryover
+	lt := ty.LongTermGains + ty.Distributions
+
+	// net a loss in one term against a gain in the other
+	if st < 0 && lt > 0 {
+		lt += st
+		st = 0
+		if lt < 0 {
+			st, lt = lt, 0
+		}
+	} else if lt < 0 && st > 0 {
+		st += lt
+		lt = 0
+		if st < 0 {
+			lt, st = st, 0
+		}
+	}
+
+	ordinary := ty.OrdinaryDividends
+	carry := Money(0)
+	if loss := -(st + lt); st <= 0 && lt <= 0 && loss > 0 {
+		maxDeduction := tm.MaxLossDeduction
+		if maxDeduction == 0 {
+			maxDeduction = defaultMaxLossDeduction
+		}
+
+		deduction := loss
+		if deduction > maxDeduction {
+			deduction = maxDeduction
+		}
+		ordinary -= deduction
+		carry = loss - deduction
+		st, lt = 0, 0
+	}
+
+	tax := ty.QualifiedDividends.Mul(tm.QualifiedRate) + ordinary.Mul(tm.OrdinaryRate) +
+		st.Mul(tm.ShortTermRate) + lt.Mul(tm.LongTermRate)
+
+	if tax < 0 {
+		tax = 0
+	}
+
+	return tax, carry
+}
@@ -0,0 +1,95 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+func TestCalcTax(t *testing.T) {
+	tm := &TaxModel{QualifiedRate: .15, OrdinaryRate: .3, ShortTermRate: .3, LongTermRate: .15}
+
+	tests := []struct {
+		name      string
+		ty        TaxYear
+		carryover Money
+		tax       Money
+		carry     Money
+	}{
+		{"dividends", TaxYear{QualifiedDividends: NewMoney(100), OrdinaryDividends: NewMoney(100)},
+			0, NewMoney(45), 0},
+		{"gains", TaxYear{ShortTermGains: NewMoney(100), LongTermGains: NewMoney(100), Distributions: NewMoney(100)},
+			0, NewMoney(60), 0},
+		{"short term loss nets long term gain", TaxYear{ShortTermGains: NewMoney(-100), LongTermGains: NewMoney(300)},
+			0, NewMoney(30), 0},
+		{"long term loss nets short term gain", TaxYear{ShortTermGains: NewMoney(300), LongTermGains: NewMoney(-100)},
+			0, NewMoney(60), 0},
+		{"loss offsets ordinary income", TaxYear{OrdinaryDividends: NewMoney(1000), LongTermGains: NewMoney(-500)},
+			0, NewMoney(150), 0},
+		{"loss carried over", TaxYear{OrdinaryDividends: NewMoney(4000), ShortTermGains: NewMoney(-5000)},
+			0, NewMoney(300), NewMoney(2000)},
+		{"carryover used", TaxYear{LongTermGains: NewMoney(3000)},
+			NewMoney(2000), NewMoney(150), 0},
+	}
+
+	for _, test := range tests {
+		tax, carry := tm.calcTax(test.ty, test.carryover)
+		if tax != test.tax || carry != test.carry {
+			t.Errorf("%s: tax %s carry %s, expected %s %s", test.name, tax, carry, test.tax, test.carry)
+		}
+	}
+}
+
+func TestAfterTax(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+
+	run := func(tax *TaxModel) *StockScenario {
+		sc := NewStockScenario(MustParseDate("2016-01-01"), MustParseDate("2020-12-31"))
+		sc.AddStock(fxaix, .6)
+		sc.AddStock(fxnax, .4)
+		sc.SetStockOptions("FXAIX", StockOptions{QualifiedPct: 1})
+		sc.Tax = tax
+		if err := sc.CalcResults(10000); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return sc
+	}
+
+	pretax := run(nil)
+	if pretax.AfterTaxEndAmt != pretax.EndAmt || pretax.AfterTaxCAGR != pretax.CAGR {
+		t.Error("after tax results differ without a tax model")
+	}
+
+	taxed := run(&TaxModel{QualifiedRate: .15, OrdinaryRate: .3, ShortTermRate: .3, LongTermRate: .15})
+	if taxed.EndAmt >= pretax.EndAmt {
+		t.Errorf("tax drag not deducted: %s %s", taxed.EndAmt, pretax.EndAmt)
+	}
+	if taxed.AfterTaxEndAmt >= taxed.EndAmt || taxed.AfterTaxCAGR >= pretax.CAGR {
+		t.Errorf("after tax results not less: %s %.4f", taxed.AfterTaxEndAmt, taxed.AfterTaxCAGR)
+	}
+
+	if len(taxed.TaxYears) != 5 {
+		t.Fatalf("expected 5 tax years: %+v", taxed.TaxYears)
+	}
+
+	// taxes paid in the results for the first 4 years
+	paid := Money(0)
+	for _, sr := range taxed.Results {
+		paid += sr.Tax
+	}
+	total := Money(0)
+	for _, ty := range taxed.TaxYears[:4] {
+		if ty.Tax <= 0 || ty.QualifiedDividends <= 0 || ty.OrdinaryDividends <= 0 {
+			t.Errorf("missing tax or dividends: %+v", ty)
+		}
+		total += ty.Tax
+	}
+	if paid != total {
+		t.Errorf("tax paid %s not total of tax years %s", paid, total)
+	}
+
+	liquidated := run(&TaxModel{QualifiedRate: .15, OrdinaryRate: .3, ShortTermRate: .3,
+		LongTermRate: .15, Liquidate: true})
+	if liquidated.AfterTaxEndAmt >= taxed.AfterTaxEndAmt {
+		t.Errorf("liquidation tax not deducted: %s", liquidated.AfterTaxEndAmt)
+	}
+}
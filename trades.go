@@ -0,0 +1,139 @@
+package portfolio
+
+import (
+	"sort"
+)
+
+// Trades returns the trades to move the holdings of each account toward
+// their targets at the close on a date. If Tax is set the targets are
+// placed in the accounts by Locate, otherwise each account is rebalanced
+// to the household target percents.
+//
+// Stocks are sold first, including all shares of stocks not in the
+// portfolio, and then the account's cash and the proceeds are used to buy
+// the stocks furthest below their targets first. Cash deposited in an
+// account before calling Trades is invested this way.
+func (p *Portfolio) Trades(date Date, opts TradeOptions) ([]Trade, error) {
+	locations, err := p.targets(date)
+	if err != nil {
+		return nil, err
+	}
+
+	var trades []Trade
+	for _, loc := range locations {
+		a := loc.Account
+		sells := !opts.CashOnly && !(opts.NoTaxableSales && a.Type == Taxable)
+		cash := a.Cash
+
+		if sells {
+			for _, h := range a.Holdings {
+				if _, err := findTicker(p.Stocks, h.Stock.Ticker); err == nil {
+					continue
+				}
+				close, err := h.Stock.closeOn(date)
+				if err != nil {
+					return nil, err
+				}
+				if trade, ok := newTrade(a, h.Stock, Sell, h.Shares, close, opts); ok {
+					trades = append(trades, trade)
+					cash += trade.Amount
+				}
+			}
+		}
+
+		// the difference between the target and current value of each stock
+		diff := make([]Money, len(p.Stocks))
+		closes := make([]Price, len(p.Stocks))
+		for i, stock := range p.Stocks {
+			close, err := stock.closeOn(date)
+			if err != nil {
+				return nil, err
+			}
+			closes[i] = close
+			diff[i] = loc.Values[i]
+			if h := a.findHolding(stock.Ticker); h != nil {
+				diff[i] -= h.Shares.Value(closes[i])
+			}
+		}
+
+		if sells {
+			for i, stock := range p.Stocks {
+				if diff[i] >= 0 {
+					continue
+				}
+				shares := closes[i].Shares(-diff[i], p.tradeDecimals(i, opts))
+				if trade, ok := newTrade(a, stock, Sell, shares, closes[i], opts); ok {
+					trades = append(trades, trade)
+					cash += trade.Amount
+				}
+			}
+		}
+
+		under := make([]int, len(p.Stocks))
+		for i := range under {
+			under[i] = i
+		}
+		sort.SliceStable(under, func(x, y int) bool {
+			return diff[under[x]] > diff[under[y]]
+		})
+
+		for _, i := range under {
+			if diff[i] <= 0 || cash <= 0 {
+				break
+			}
+			shares := closes[i].Shares(minMoney(diff[i], cash), p.tradeDecimals(i, opts))
+			if trade, ok := newTrade(a, p.Stocks[i], Buy, shares, closes[i], opts); ok {
+				trades = append(trades, trade)
+				cash -= trade.Amount
+			}
+		}
+	}
+
+	return trades, nil
+}
+
+// targets returns the target value of each stock in each account.
+func (p *Portfolio) targets(date Date) ([]Location, error) {
+	if p.Tax != nil {
+		return p.Locate(date)
+	}
+
+	var locations []Location
+	for _, a := range p.Accounts {
+		value, err := a.Value(date)
+		if err != nil {
+			return nil, err
+		}
+
+		loc := Location{Account: a, Values: make([]Money, len(p.Stocks))}
+		for i, stock := range p.Stocks {
+			if _, err := stock.closeOn(date); err != nil {
+				return nil, err
+			}
+			loc.Values[i] = value.Mul(p.PctHolding[i])
+		}
+		locations = append(locations, loc)
+	}
+
+	return locations, nil
+}
+
+// tradeDecimals returns the decimals of a share stock i is traded in.
+func (p *Portfolio) tradeDecimals(i int, opts TradeOptions) int {
+	if opts.WholeShares {
+		return 0
+	}
+	return p.Options[i].Rounding.decimals()
+}
+
+// newTrade returns a trade of shares at a price, and false if
+// the trade is for less than the minimum trade.
+func newTrade(a *Account, stock *Stock, action TransactionAction, shares Quantity, price Price, opts TradeOptions) (Trade, bool) {
+	amount := shares.Value(price)
+	if shares <= 0 || amount < opts.MinTrade {
+		return Trade{}, false
+	}
+
+	return Trade{Account: a.Name, Ticker: stock.Ticker, Action: action,
+		Shares: shares, Price: price, Amount: amount}, true
+}
@@ -0,0 +1,84 @@
+package portfolio
+
+import (
+	"testing"
+)
+
+func TestTrades(t *testing.T) {
+	fxaix, _ := NewStock("FXAIX")
+	fxnax, _ := NewStock("FXNAX")
+	vig, _ := NewStock("VIG")
+	date := MustParseDate("2021-06-01")
+
+	p := NewPortfolio("household")
+	p.AddStock(fxaix, .6)
+	p.AddStock(fxnax, .4)
+	a, _ := p.AddAccount("brokerage", Taxable)
+	a.AddHolding(fxaix, NewQuantity(100), nil)
+	a.AddHolding(vig, NewQuantity(10), nil)
+	a.Cash = NewMoney(5000)
+
+	value, _ := p.Value(date)
+
+	trades, err := p.Trades(date, TradeOptions{WholeShares: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// apply the trades
+	shares := map[string]Quantity{"FXAIX": NewQuantity(100), "VIG": NewQuantity(10)}
+	cash := a.Cash
+	for _, trade := range trades {
+		if trade.Shares.Round(0) != trade.Shares {
+			t.Errorf("not whole shares: %+v", trade)
+		}
+		if trade.Action == Sell {
+			shares[trade.Ticker] -= trade.Shares
+			cash += trade.Amount
+		} else {
+			shares[trade.Ticker] += trade.Shares
+			cash -= trade.Amount
+		}
+	}
+
+	if shares["VIG"] != 0 {
+		t.Errorf("stock not in portfolio not sold: %v", trades)
+	}
+	if cash < 0 {
+		t.Errorf("cash %s after trades", cash)
+	}
+
+	for i, stock := range p.Stocks {
+		close, _ := stock.closeOn(date)
+		pct := shares[stock.Ticker].Value(close).Float() / value.Float()
+		if pct < p.PctHolding[i]-.01 || pct > p.PctHolding[i]+.01 {
+			t.Errorf("%s %g of account after trades, expected %g", stock.Ticker, pct, p.PctHolding[i])
+		}
+	}
+
+	// cash only and no taxable sales only buy with the cash
+	for _, opts := range []TradeOptions{{CashOnly: true}, {NoTaxableSales: true}} {
+		trades, _ = p.Trades(date, opts)
+		spent := Money(0)
+		for _, trade := range trades {
+			if trade.Action == Sell {
+				t.Errorf("%+v sold %+v", opts, trade)
+			}
+			spent += trade.Amount
+		}
+		if len(trades) == 0 || spent > a.Cash {
+			t.Errorf("%+v spent %s of %s", opts, spent, a.Cash)
+		}
+	}
+
+	// the most underweight stock is bought first
+	trades, _ = p.Trades(date, TradeOptions{CashOnly: true})
+	if trades[0].Ticker != "FXNAX" {
+		t.Errorf("FXNAX not bought first: %+v", trades)
+	}
+
+	trades, _ = p.Trades(date, TradeOptions{MinTrade: NewMoney(1000000)})
+	if len(trades) != 0 {
+		t.Errorf("trades less than minimum: %+v", trades)
+	}
+}
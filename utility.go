@@ -7,7 +7,8 @@ import (
 
 // Read a CSV array from a file
 // where the first row contains the column names
-// and subsequent columns contain column values in string format
+// and subsequent columns contain column values in string format.
+// Rows may have different numbers of columns.
 func readCSVFile(file string) ([][]string, error) {
 
 	f, err := os.Open(file)
@@ -15,7 +16,9 @@ func readCSVFile(file string) ([][]string, error) {
 		return nil, err
 	}
 
-	records, err := csv.NewReader(f).ReadAll()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
 	f.Close()
 
 	return records, err